@@ -1,10 +1,13 @@
 package admin
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"regexp"
 	"strconv"
+	"time"
 
 	"github.com/mdesson/CatFactsForever/factmanager"
 	"github.com/mdesson/CatFactsForever/scheduler"
@@ -14,20 +17,38 @@ import (
 // Help displays the list of admin commands
 func Help() string {
 	return `Admin commands are:
-add name +1XXXYYYZZZZ suscriptionID category - add user
+add name +1XXXYYYZZZZ suscriptionID category [zone] - add user, optionally in a time zone such as America/Vancouver
 
 start name - enables sms on user
 
-stop name - disables sms on user
+stop name [days] - disables sms on user, optionally for a number of days
+
+send name YYYY-MM-DD HH:MM message - texts a message to user at a set time in their time zone
 
 info name - details about user
 
-update name subscriptionID - change user's schedule
+update name subscriptionID [zone] - change user's schedule, and optionally their time zone
 
 list users - lists all users
 
 list schedules - lists all schedules
 
+preview subscriptionID - shows upcoming send times
+
+sync jobs - applies subscription changes to the scheduler
+
+status - shows if the scheduler is alive
+
+blackout add YYYY-MM-DD [category] - no facts on a date
+
+blackout add yearly MM-DD [category] - no facts on a date every year
+
+blackout add quiet HH:MM HH:MM [category] - no facts during daily quiet hours
+
+blackout list - lists all blackouts
+
+blackout remove blackoutID - removes a blackout
+
 reset confirm - deletes all data [DANGER]
 
 populate confirm - puts in starter data [DANGER]
@@ -57,6 +78,11 @@ func ListUsers(db *gorm.DB) string {
 	return output
 }
 
+// Status displays the scheduler's liveness
+func Status() string {
+	return scheduler.Liveness().String()
+}
+
 // ListJobs displays a list of all jobs and their status
 func ListJobs() string {
 	statuses := scheduler.Statuses()
@@ -67,7 +93,44 @@ func ListJobs() string {
 	return output
 }
 
-// ListSubscriptions displays the name and ID of each available subscription type
+// CancelJob aborts the in-flight run of a job
+func CancelJob(id string) string {
+	job, ok := scheduler.FindJob(id)
+	if !ok {
+		return "job not found. try 'list jobs'"
+	}
+	if !job.Cancel() {
+		return fmt.Sprintf("job %v is not running", id)
+	}
+	return fmt.Sprintf("cancelled the current run of job %v", id)
+}
+
+// JobHistory displays the most recent runs of a job
+func JobHistory(id string, db *gorm.DB) string {
+	runs, err := factmanager.RecentJobRuns(db, id, 10)
+	if err != nil {
+		log.Printf("error fetching history of job %v: %v", id, err)
+		return "an error occurred fetching job history"
+	}
+	if len(runs) == 0 {
+		return fmt.Sprintf("no runs recorded for job %v", id)
+	}
+
+	output := fmt.Sprintf("Recent runs of job %v:\n", id)
+	for _, run := range runs {
+		output = fmt.Sprintf("%v%v: %v in %v, %v users", output, run.ScheduledAt.Format("Mon Jan 2 15:04"), run.Outcome, run.Duration.Round(time.Millisecond), run.UsersMessaged)
+		if run.UsersFailed > 0 || run.UsersSkipped > 0 {
+			output = fmt.Sprintf("%v, %v failed, %v skipped", output, run.UsersFailed, run.UsersSkipped)
+		}
+		if run.Error != "" {
+			output = fmt.Sprintf("%v (%v)", output, run.Error)
+		}
+		output += "\n"
+	}
+	return output
+}
+
+// ListSubscriptions displays the name, ID and schedule of each available subscription type
 func ListSubscriptions(db *gorm.DB) string {
 	output := "Schedule IDs and names:\n"
 
@@ -82,25 +145,95 @@ func ListSubscriptions(db *gorm.DB) string {
 	}
 
 	for _, schedule := range schedules {
-		output = fmt.Sprintf("%v%v: %v\n", output, schedule.ID, schedule.Frequency)
+		// Describe the schedule from its cron string rather than the stored description, which may be stale
+		desc, err := schedule.Schedule()
+		if err != nil {
+			desc = fmt.Sprintf("invalid schedule: %v", err)
+		}
+		output = fmt.Sprintf("%v%v: %v - %v\n", output, schedule.ID, schedule.Frequency, desc)
+	}
+	return output
+}
+
+// Preview displays the next few times a subscription will send
+func Preview(subID string, db *gorm.DB) string {
+	sub := &factmanager.Subscription{}
+	if err := db.Where("id = ?", subID).First(sub).Error; err != nil {
+		return "subscription id not found. try 'list schedules'"
+	}
+
+	schedule, err := scheduler.ParseSchedule(sub.Cron)
+	if err != nil {
+		return fmt.Sprintf("subscription %v has an invalid schedule: %v", sub.Frequency, err)
+	}
+
+	// Sends are spread at random after each cron time by the window and jitter
+	spread := time.Duration(sub.WindowMinutes+sub.JitterMinutes) * time.Minute
+
+	// Schedules are evaluated in each user's time zone, like the scheduler the preview uses the default one
+	loc, err := factmanager.LoadTimeZone("")
+	if err != nil {
+		return fmt.Sprintf("an error occurred loading time zone %v", factmanager.DefaultTimeZone)
+	}
+
+	output := fmt.Sprintf("Next sends for %v in %v:\n", sub.Frequency, loc)
+	next := time.Now().In(loc)
+	for i := 0; i < 5; i++ {
+		next = schedule.Next(next)
+		if next.IsZero() {
+			break
+		}
+		if spread > 0 {
+			output = fmt.Sprintf("%v%v to %v\n", output, next.Format("Mon Jan 2 15:04"), next.Add(spread).Format("15:04 MST"))
+		} else {
+			output = fmt.Sprintf("%v%v\n", output, next.Format("Mon Jan 2 15:04 MST"))
+		}
 	}
 	return output
 }
 
 // Start will set the user to active
 func Start(name string, db *gorm.DB) string {
-	if err := db.Model(&factmanager.CatEnthusiast{}).Where("name = ?", name).Update("active", true).Error; err != nil {
-		log.Printf("error setting user %v to active: %v", name, err)
-		return "an error occurred setting user to active"
-	}
-	return "done"
+	// Starting a user by hand replaces any pending resume
+	scheduler.RemoveJob(resumeJobID(name))
+	return setActive(name, true, db)
 }
 
 // Stop will set the user to inactive
 func Stop(name string, db *gorm.DB) string {
-	if err := db.Model(&factmanager.CatEnthusiast{}).Where("name = ?", name).Update("active", false).Error; err != nil {
-		log.Printf("error setting user %v to inactive: %v", name, err)
-		return "an error occurred setting user to inactive"
+	scheduler.RemoveJob(resumeJobID(name))
+	return setActive(name, false, db)
+}
+
+// StopFor disables sms on user and schedules them to be enabled again after a number of days
+func StopFor(name, days string, db *gorm.DB) string {
+	n, err := strconv.Atoi(days)
+	if err != nil || n < 1 {
+		return "make sure the number of days is a positive number"
+	}
+	if err := db.Where("name = ?", name).First(&factmanager.CatEnthusiast{}).Error; err != nil {
+		return "user not found. try 'list users'"
+	}
+	if reply := Stop(name, db); reply != "done" {
+		return reply
+	}
+	delay := time.Duration(n) * 24 * time.Hour
+	if err := scheduler.AddDelayed(resumeJobID(name), delay, ResumeKind, name); err != nil {
+		log.Printf("error scheduling resume of user %v: %v", name, err)
+		return "stopped, but an error occurred scheduling the restart. use 'start' later"
+	}
+	return fmt.Sprintf("stopped %v until %v", name, time.Now().Add(delay).Format("Mon Jan 2 15:04"))
+}
+
+// setActive enables or disables sms on user
+func setActive(name string, active bool, db *gorm.DB) string {
+	status := "inactive"
+	if active {
+		status = "active"
+	}
+	if err := db.Model(&factmanager.CatEnthusiast{}).Where("name = ?", name).Update("active", active).Error; err != nil {
+		log.Printf("error setting user %v to %v: %v", name, status, err)
+		return fmt.Sprintf("an error occurred setting user to %v", status)
 	}
 	return "done"
 }
@@ -117,19 +250,29 @@ Phone: %v
 Active: %v
 Category: %v
 SubscriptionID: %v
+Time zone: %v
 Total cat facts: %v`,
 		user.Name,
 		user.PhoneNumber,
 		user.Active,
 		user.FactCategory,
 		user.SubscriptionID,
+		user.Zone(),
 		user.TotalSent)
 
+	// Delivery statuses are only known for texts sent since they started being tracked
+	if stats, err := factmanager.UserDeliveryStats(db, user.ID); err != nil {
+		log.Printf("Error fetching delivery stats of %v: %v", user.Name, err)
+	} else {
+		userInfo = fmt.Sprintf("%v\nDelivery: %v", userInfo, stats)
+	}
+
 	return userInfo
 }
 
-// Add will add a new user
-func Add(userName, phoneNumber, subID, category string, db *gorm.DB) (reply, frequency string, ok bool) {
+// Add will add a new user, in the default time zone if zone is empty
+// Returns the admin reply and an English description of when the user will be sent facts
+func Add(userName, phoneNumber, subID, category, zone string, db *gorm.DB) (reply, schedule string, ok bool) {
 	// Validate phone number format
 	r := regexp.MustCompile(`\+1\d{10}`)
 	if !r.MatchString(phoneNumber) {
@@ -148,6 +291,15 @@ func Add(userName, phoneNumber, subID, category string, db *gorm.DB) (reply, fre
 		return "subscription id not found. try 'list subscriptions'", "", false
 	}
 
+	// Validate time zone, and store its proper name
+	if zone != "" {
+		loc, err := factmanager.LoadTimeZone(zone)
+		if err != nil {
+			return "unknown time zone, use a name such as America/Vancouver", "", false
+		}
+		zone = loc.String()
+	}
+
 	// Validate unique name and phone number
 	// gorm will not return error if unique constraint is violated
 	u := &factmanager.CatEnthusiast{}
@@ -161,17 +313,23 @@ func Add(userName, phoneNumber, subID, category string, db *gorm.DB) (reply, fre
 		Active:           true,
 		FactCategory:     category,
 		SubscriptionID:   uint(uintSubID),
+		TimeZone:         zone,
 		TotalSentSession: 0,
 		TotalSent:        0,
 	}
 	if err := db.Create(user).Error; err != nil {
 		return "", "something went wrong, it's probably not your fault", false
 	}
-	return fmt.Sprintf("%v was added with the subscription %v", user.Name, sub.Frequency), sub.Frequency, true
+	schedule, err = sub.Schedule()
+	if err != nil {
+		log.Printf("error describing subscription %v: %v", sub.Frequency, err)
+		schedule = sub.Frequency
+	}
+	return fmt.Sprintf("%v was added with the subscription %v in %v", user.Name, sub.Frequency, user.Zone()), schedule, true
 }
 
-// Update will alter the user's subscription
-func Update(userName, subID string, db *gorm.DB) string {
+// Update will alter the user's subscription, and their time zone unless zone is empty
+func Update(userName, subID, zone string, db *gorm.DB) string {
 	// Validate subscription ID is int
 	uID, err := strconv.ParseUint(subID, 10, 32)
 	if err != nil {
@@ -187,6 +345,13 @@ func Update(userName, subID string, db *gorm.DB) string {
 	if err := db.Where("id = ?", subID).First(sub).Error; err != nil {
 		return "subscription id not found. try 'list subscriptions'"
 	}
+	if zone != "" {
+		loc, err := factmanager.LoadTimeZone(zone)
+		if err != nil {
+			return "unknown time zone, use a name such as America/Vancouver"
+		}
+		user.TimeZone = loc.String()
+	}
 
 	// Update data, notify on error
 	user.SubscriptionID = uint(uID)
@@ -194,5 +359,143 @@ func Update(userName, subID string, db *gorm.DB) string {
 		return "error saving new user's subscription.\nNot your fault, user and subscription both exist"
 	}
 
-	return fmt.Sprintf("%v's subscripion is now %v", user.Name, sub.Frequency)
+	return fmt.Sprintf("%v's subscripion is now %v in %v", user.Name, sub.Frequency, user.Zone())
+}
+
+// AddBlackout adds a blackout rule from the words following 'blackout add'
+// Accepts 'YYYY-MM-DD', 'yearly MM-DD' or 'quiet HH:MM HH:MM', optionally followed by a category
+func AddBlackout(args []string, db *gorm.DB) string {
+	if len(args) == 0 {
+		return "bad format for blackout. see help"
+	}
+
+	// A bare date is a one-off blackout
+	kind := args[0]
+	values := args[1:]
+	if kind != factmanager.BlackoutQuiet && kind != factmanager.BlackoutYearly {
+		kind, values = factmanager.BlackoutDate, args
+	}
+	need := 1
+	if kind == factmanager.BlackoutQuiet {
+		need = 2
+	}
+	if len(values) != need && len(values) != need+1 {
+		return "bad format for blackout. see help"
+	}
+	category := ""
+	if len(values) > need {
+		category = values[need]
+	}
+
+	rule, err := factmanager.NewBlackoutRule(kind, category, values[:need]...)
+	if err != nil {
+		return fmt.Sprintf("invalid blackout: %v", err)
+	}
+	if err := db.Create(rule).Error; err != nil {
+		log.Printf("error adding blackout %v: %v", rule, err)
+		return "an error occurred saving the blackout"
+	}
+	return fmt.Sprintf("added blackout %v: %v", rule.ID, rule)
+}
+
+// ListBlackouts displays every blackout rule and its ID
+func ListBlackouts(db *gorm.DB) string {
+	rules, err := factmanager.ListBlackoutRules(db)
+	if err != nil {
+		log.Printf("error listing blackouts: %v", err)
+		return "an error occurred fetching blackouts"
+	}
+	if len(rules) == 0 {
+		return "no blackouts, use 'blackout add' to add some"
+	}
+	output := "Blackout IDs and rules:\n"
+	for _, rule := range rules {
+		output = fmt.Sprintf("%v%v: %v\n", output, rule.ID, rule)
+	}
+	return output
+}
+
+// RemoveBlackout deletes a blackout rule by ID
+func RemoveBlackout(id string, db *gorm.DB) string {
+	if _, err := strconv.ParseUint(id, 10, 32); err != nil {
+		return "make sure the blackout ID is a number"
+	}
+	result := db.Unscoped().Where("id = ?", id).Delete(&factmanager.BlackoutRule{})
+	if result.Error != nil {
+		log.Printf("error removing blackout %v: %v", id, result.Error)
+		return "an error occurred removing the blackout"
+	}
+	if result.RowsAffected == 0 {
+		return "blackout not found. try 'blackout list'"
+	}
+	return fmt.Sprintf("removed blackout %v", id)
+}
+
+// Kinds of one-shot jobs scheduled by admin commands
+const (
+	SendKind   = "send"   // Texts a message to a user, the payload is a ScheduledText
+	ResumeKind = "resume" // Enables sms on a user again, the payload is their name
+)
+
+// ScheduledText is the payload of a SendKind job
+type ScheduledText struct {
+	Name    string // User to text
+	Message string // Message to send
+}
+
+// resumeJobID returns the ID of the job that enables sms on a stopped user
+func resumeJobID(name string) string {
+	return fmt.Sprintf("resume/%v", name)
+}
+
+// ResumeHandler builds the jobs that enable sms on a user again after 'stop name days'
+func ResumeHandler(db *gorm.DB) scheduler.OneShotHandler {
+	return func(name string) (scheduler.JobFunc, error) {
+		return func(ctx context.Context) error {
+			if reply := setActive(name, true, db); reply != "done" {
+				return fmt.Errorf("Error resuming user %v: %v", name, reply)
+			}
+			return nil
+		}, nil
+	}
+}
+
+// ScheduleText schedules a message to a user at a date and time in their time zone
+func ScheduleText(name, date, clock, message string, db *gorm.DB) string {
+	user := &factmanager.CatEnthusiast{}
+	if err := db.Where("name = ?", name).First(user).Error; err != nil {
+		return "user not found. try 'list users'"
+	}
+	loc, err := user.Location()
+	if err != nil {
+		log.Printf("error loading time zone of %v: %v", name, err)
+		return "an error occurred loading the user's time zone"
+	}
+	at, err := time.ParseInLocation("2006-01-02 15:04", fmt.Sprintf("%v %v", date, clock), loc)
+	if err != nil {
+		return "bad date or time. use YYYY-MM-DD HH:MM"
+	}
+	if !at.After(time.Now()) {
+		return "that time has already passed"
+	}
+
+	payload, err := json.Marshal(ScheduledText{Name: name, Message: message})
+	if err != nil {
+		log.Printf("error encoding message to %v: %v", name, err)
+		return "an error occurred scheduling the message"
+	}
+	id := fmt.Sprintf("send/%v/%v", name, at.Format("200601021504"))
+	if err := scheduler.AddOneShot(id, at, SendKind, string(payload)); err != nil {
+		log.Printf("error scheduling message to %v: %v", name, err)
+		return fmt.Sprintf("couldn't schedule the message: %v", err)
+	}
+	return fmt.Sprintf("will text %v at %v. job %v", name, at.Format("Mon Jan 2 15:04 MST"), id)
+}
+
+// RemoveJob removes a job from the scheduler, one-shot jobs are deleted for good
+func RemoveJob(id string) string {
+	if !scheduler.RemoveJob(id) {
+		return "job not found. try 'list jobs'"
+	}
+	return fmt.Sprintf("removed job %v", id)
 }
@@ -6,7 +6,10 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
+	_ "time/tzdata" // Users' time zones load even where the system has no zone database
 
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
@@ -15,6 +18,70 @@ import (
 	"github.com/mdesson/CatFactsForever/sms"
 )
 
+// pruneJobID is the scheduler ID of the job that prunes old run history
+const pruneJobID = "prune-history"
+
+// schedulerLockKey is the postgres advisory lock replicas compete for when LEADER_ELECTION is on
+const schedulerLockKey = 0x43617446 // "CatF"
+
+// syncJobID is the scheduler ID of the job that syncs subscription jobs with the database
+const syncJobID = "sync-subscriptions"
+
+// logListener logs runs that fail or are skipped
+type logListener struct {
+	scheduler.NopListener
+}
+
+func (logListener) OnError(e scheduler.Event) {
+	log.Printf("Job %v failed attempt %v for %v: %v", e.JobID, e.Attempt, e.Scheduled.Format("Mon Jan 2 15:04"), e.Err)
+}
+
+func (logListener) OnSkipped(e scheduler.Event) {
+	log.Printf("Job %v skipped its run for %v: %v", e.JobID, e.Scheduled.Format("Mon Jan 2 15:04"), e.Reason)
+}
+
+// healthHandler reports the scheduler's liveness, failing with 503 when it is stopped or stalled
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	health := scheduler.Liveness()
+	if !health.Healthy() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	fmt.Fprintln(w, health)
+}
+
+// watchdog logs and texts the admins when the scheduler loop stalls or recovers from panics
+func watchdog(health scheduler.Health) {
+	log.Printf("Scheduler watchdog: %v", health)
+	sms.AlertAdmins(fmt.Sprintf("CAT FACTS scheduler needs attention: %v", health))
+}
+
+// newSender makes the SMS provider named by SMS_PROVIDER: twilio, console or file
+// The dry run providers print texts instead of sending them, file appends them to SMS_DRY_RUN_FILE
+func newSender(provider string) (sms.Sender, error) {
+	switch provider {
+	case "", "twilio":
+		// Delivery statuses can only be posted back to a server with a known public URL
+		twilio := &sms.Twilio{SID: os.Getenv("SID"), Token: os.Getenv("TOKEN"), From: os.Getenv("FROM")}
+		if publicURL := os.Getenv("PUBLIC_URL"); publicURL != "" {
+			twilio.StatusCallback = strings.TrimSuffix(publicURL, "/") + "/sms/status"
+		}
+		return twilio, nil
+	case "console":
+		return &sms.DryRun{Out: os.Stdout, From: os.Getenv("FROM")}, nil
+	case "file":
+		path := os.Getenv("SMS_DRY_RUN_FILE")
+		if path == "" {
+			path = "catfacts-texts"
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+		if err != nil {
+			return nil, fmt.Errorf("Error opening dry run file: %v", err)
+		}
+		return &sms.DryRun{Out: f, From: os.Getenv("FROM")}, nil
+	}
+	return nil, fmt.Errorf("SMS_PROVIDER must be twilio, console or file, not %q", provider)
+}
+
 func main() {
 	// Begin logging to file
 	f, err := os.OpenFile("catfacts-logs", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
@@ -29,15 +96,27 @@ func main() {
 	if err := godotenv.Load(); err != nil {
 		log.Fatal("Please include an .env file with SID and TOKEN values from Twilio")
 	}
-	sid := os.Getenv("SID")
-	token := os.Getenv("TOKEN")
-	from := os.Getenv("FROM")
 	dbUser := os.Getenv("DB_USER")
 	dbHost := os.Getenv("DB_HOST")
 	dbPass := os.Getenv("DB_PASS")
 	dbName := os.Getenv("DB_NAME")
 	dbPort := os.Getenv("DB_PORT")
 
+	// Optionally change the time zone of users who haven't set their own
+	if tz := os.Getenv("TIME_ZONE"); tz != "" {
+		if _, err := factmanager.LoadTimeZone(tz); err != nil {
+			log.Fatalf("TIME_ZONE must be an IANA time zone: %v", err)
+		}
+		factmanager.DefaultTimeZone = tz
+	}
+
+	// Texts are sent with Twilio unless a dry run provider is configured
+	textSender, err := newSender(os.Getenv("SMS_PROVIDER"))
+	if err != nil {
+		log.Fatalf("Error setting up SMS provider: %v", err)
+	}
+	sms.SetSender(textSender)
+
 	// Initialize database
 	db, err := factmanager.Init(dbHost, dbUser, dbPass, dbName, dbPort)
 	if err != nil {
@@ -58,47 +137,85 @@ func main() {
 		log.Println("Completed database population")
 	}
 
+	// Optionally bound how many subscription jobs send at once
+	workers := scheduler.DefaultWorkers
+	if w := os.Getenv("SCHEDULER_WORKERS"); w != "" {
+		if workers, err = strconv.Atoi(w); err != nil {
+			log.Fatalf("SCHEDULER_WORKERS must be a number: %v", err)
+		}
+	}
+
+	// Keep run history for 30 days unless configured otherwise
+	retentionDays := 30
+	if d := os.Getenv("HISTORY_RETENTION_DAYS"); d != "" {
+		if retentionDays, err = strconv.Atoi(d); err != nil {
+			log.Fatalf("HISTORY_RETENTION_DAYS must be a number: %v", err)
+		}
+	}
+
+	// Job state, run history and one-shot jobs are kept in postgres so they survive a restart
+	jobStore := &factmanager.JobStore{DB: db}
+	opts := []scheduler.Option{
+		scheduler.WithWorkers(workers),
+		scheduler.WithStore(jobStore),
+		scheduler.WithHistory(jobStore),
+		scheduler.WithOneShotStore(jobStore),
+		scheduler.WithListener(logListener{}),
+		scheduler.WithListener(&sms.AdminAlerts{}),
+		scheduler.WithWatchdog(watchdog),
+	}
+
+	// With several replicas only the leader sends facts, every replica still answers texts
+	if leaderElection, _ := strconv.ParseBool(os.Getenv("LEADER_ELECTION")); leaderElection {
+		opts = append(opts, scheduler.WithLeader(&factmanager.AdvisoryLock{DB: db, Key: schedulerLockKey}))
+	}
+	scheduler.SetDefault(scheduler.New(scheduler.RealClock(), opts...))
+
 	msg := factmanager.MakeFactMessage("cat", db)
 	log.Println(msg)
 
-	schedules := []factmanager.Subscription{}
-	if err := db.Find(&schedules).Error; err != nil {
-		log.Printf("Error listing subscriptions: %v", err)
-	}
-
-	// Add the fact sms job to the scheduler
-	for _, s := range schedules {
-		subscription := s
-		jobFunc := func(ctx context.Context) error {
-			users := []factmanager.CatEnthusiast{}
-			if err := db.Where("subscription_id = ?", subscription.ID).Find(&users).Error; err != nil {
-				return fmt.Errorf("Error fetching users that have subscriptionID %v: %v", subscription.ID, err)
-			}
-			for _, user := range users {
-				if user.Active {
-					msg := factmanager.MakeFactMessage(user.FactCategory, db)
-					respCode := sms.SendText(msg, sid, token, user.PhoneNumber, from)
-					// If http response from Twilio is other than 201, register error
-					if respCode != 201 {
-						return fmt.Errorf("Error sending text message to %v with code %v", user.Name, respCode)
-					}
-					// If no error occurred, update the total messages sent to the user and the total number of thanks
-					if err := db.Model(&user).Updates(&factmanager.CatEnthusiast{TotalSent: (user.TotalSent + 1), TotalSentSession: (user.TotalSentSession + 1)}).Error; err != nil {
-						return fmt.Errorf("Error updating user %v's stats: %v", user.Name, err)
-					}
-				}
-			}
-			return nil
+	// One-shot jobs from admin commands are restored when the scheduler starts
+	sms.HandleOneShots(db)
+
+	// Register one fact sms job per subscription, and keep them in step with the database on every replica
+	if _, err := sms.SyncJobs(db); err != nil {
+		log.Printf("Error registering subscription jobs: %v", err)
+	}
+	syncFunc := func(ctx context.Context) error {
+		result, err := sms.SyncJobs(db)
+		if err != nil {
+			return err
+		}
+		if result != (sms.SyncResult{}) {
+			log.Printf("Synced subscription jobs: %+v", result)
 		}
+		return nil
+	}
+	if err := scheduler.AddJob(syncJobID, "*/5 * * * *", "Syncs subscription jobs with the database", true, syncFunc, scheduler.WithAllReplicas()); err != nil {
+		log.Fatalf("Error registering subscription sync job with scheduler:\n%v", err)
+	}
 
-		if err := scheduler.AddJob(fmt.Sprint(subscription.ID), subscription.Cron, subscription.Description, true, true, jobFunc); err != nil {
-			log.Fatalf("Error registering cat facts job with scheduler:\n%v", err)
+	// Prune run history older than the retention period every night
+	pruneFunc := func(ctx context.Context) error {
+		deleted, err := factmanager.PruneJobRuns(db, time.Now().AddDate(0, 0, -retentionDays))
+		if err != nil {
+			return fmt.Errorf("Error pruning job history: %v", err)
 		}
+		log.Printf("Pruned %v job runs older than %v days", deleted, retentionDays)
+		return nil
+	}
+	if err := scheduler.AddJob(pruneJobID, "0 3 * * *", "Prunes old job history", true, pruneFunc); err != nil {
+		log.Fatalf("Error registering history pruning job with scheduler:\n%v", err)
 	}
 	go scheduler.Start()
 
+	// A handler that panics fails its request instead of taking the server down
 	r := mux.NewRouter()
-	r.HandleFunc("/sms", sms.MakeResponseHandler(db)).Methods("POST")
+	r.Use(sms.RecoverPanics)
+	// Only texts Twilio signed with our auth token are answered, so admin commands can't be forged
+	r.HandleFunc("/sms", sms.RequireSignature(os.Getenv("TOKEN"), os.Getenv("PUBLIC_URL"), sms.MakeResponseHandler(db))).Methods("POST")
+	r.HandleFunc("/sms/status", sms.RequireSignature(os.Getenv("TOKEN"), os.Getenv("PUBLIC_URL"), sms.MakeStatusHandler(db))).Methods("POST")
+	r.HandleFunc("/health", healthHandler).Methods("GET")
 	http.Handle("/", r)
 	if err = http.ListenAndServe(":8080", nil); err != nil {
 		log.Fatalf("Error starting on server on ':8080':\n%v\n", err)
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mdesson/CatFactsForever/sms"
+)
+
+func TestNewSender(t *testing.T) {
+	os.Setenv("PUBLIC_URL", "https://catfacts.example.com/")
+	defer os.Unsetenv("PUBLIC_URL")
+	path := filepath.Join(t.TempDir(), "texts")
+	os.Setenv("SMS_DRY_RUN_FILE", path)
+	defer os.Unsetenv("SMS_DRY_RUN_FILE")
+
+	for _, provider := range []string{"", "twilio"} {
+		s, err := newSender(provider)
+		twilio, ok := s.(*sms.Twilio)
+		if err != nil || !ok {
+			t.Errorf("newSender(%q) = %T, %v, want Twilio", provider, s, err)
+			continue
+		}
+		if want := "https://catfacts.example.com/sms/status"; twilio.StatusCallback != want {
+			t.Errorf("newSender(%q) posts statuses to %q, want %q", provider, twilio.StatusCallback, want)
+		}
+	}
+
+	s, err := newSender("console")
+	if dryRun, ok := s.(*sms.DryRun); err != nil || !ok || dryRun.Out != os.Stdout {
+		t.Errorf("newSender(\"console\") = %#v, %v, want a dry run to the console", s, err)
+	}
+
+	s, err = newSender("file")
+	dryRun, ok := s.(*sms.DryRun)
+	if err != nil || !ok {
+		t.Fatalf("newSender(\"file\") = %T, %v, want a dry run to a file", s, err)
+	}
+	if f, ok := dryRun.Out.(*os.File); !ok || f.Name() != path {
+		t.Errorf("newSender(\"file\") writes to %v, want %v", dryRun.Out, path)
+	} else {
+		f.Close()
+	}
+
+	if s, err := newSender("carrier pigeon"); err == nil {
+		t.Errorf("newSender(\"carrier pigeon\") = %T, want an error", s)
+	}
+}
@@ -0,0 +1,144 @@
+package factmanager
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Kinds of BlackoutRule
+const (
+	BlackoutQuiet  = "quiet"  // Every day between Start and End
+	BlackoutDate   = "date"   // All day on Date
+	BlackoutYearly = "yearly" // All day on Date every year
+)
+
+// Layouts of BlackoutRule's Date, Start and End
+const (
+	blackoutDateLayout   = "2006-01-02"
+	blackoutYearlyLayout = "01-02"
+	blackoutClockLayout  = "15:04"
+)
+
+// NewBlackoutRule builds and validates a rule of the given kind
+// Date rules take a YYYY-MM-DD date, yearly rules take MM-DD, and quiet rules take HH:MM start and end times
+func NewBlackoutRule(kind, category string, values ...string) (*BlackoutRule, error) {
+	rule := &BlackoutRule{Kind: kind, Category: category}
+	switch kind {
+	case BlackoutDate, BlackoutYearly:
+		if len(values) != 1 {
+			return nil, fmt.Errorf("A %v blackout takes one date", kind)
+		}
+		rule.Date = values[0]
+	case BlackoutQuiet:
+		if len(values) != 2 {
+			return nil, fmt.Errorf("Quiet hours take a start and an end time")
+		}
+		rule.Start, rule.End = values[0], values[1]
+	default:
+		return nil, fmt.Errorf("Unknown blackout kind %q", kind)
+	}
+	if _, _, err := rule.Covers(time.Now()); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// String describes the rule, such as "quiet hours 22:00-09:00 for cat"
+func (b BlackoutRule) String() string {
+	var desc string
+	switch b.Kind {
+	case BlackoutQuiet:
+		desc = fmt.Sprintf("quiet hours %v-%v", b.Start, b.End)
+	case BlackoutYearly:
+		desc = fmt.Sprintf("every %v", b.Date)
+	default:
+		desc = b.Date
+	}
+	if b.Category != "" {
+		desc = fmt.Sprintf("%v for %v", desc, b.Category)
+	}
+	return desc
+}
+
+// Covers reports if t falls in the rule and, if so, when the blackout ends
+// Dates and times are read in t's location
+func (b BlackoutRule) Covers(t time.Time) (until time.Time, ok bool, err error) {
+	y, m, d := t.Date()
+	midnight := time.Date(y, m, d+1, 0, 0, 0, 0, t.Location())
+
+	switch b.Kind {
+	case BlackoutDate:
+		if _, err := time.Parse(blackoutDateLayout, b.Date); err != nil {
+			return time.Time{}, false, fmt.Errorf("Invalid date %q, use YYYY-MM-DD", b.Date)
+		}
+		return midnight, t.Format(blackoutDateLayout) == b.Date, nil
+	case BlackoutYearly:
+		if _, err := time.Parse(blackoutYearlyLayout, b.Date); err != nil {
+			return time.Time{}, false, fmt.Errorf("Invalid date %q, use MM-DD", b.Date)
+		}
+		return midnight, t.Format(blackoutYearlyLayout) == b.Date, nil
+	case BlackoutQuiet:
+		start, err := time.Parse(blackoutClockLayout, b.Start)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("Invalid start time %q, use HH:MM", b.Start)
+		}
+		end, err := time.Parse(blackoutClockLayout, b.End)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("Invalid end time %q, use HH:MM", b.End)
+		}
+		now := t.Hour()*60 + t.Minute()
+		from := start.Hour()*60 + start.Minute()
+		to := end.Hour()*60 + end.Minute()
+		endToday := time.Date(y, m, d, end.Hour(), end.Minute(), 0, 0, t.Location())
+		switch {
+		case from < to && now >= from && now < to:
+			return endToday, true, nil
+		case from > to && now >= from:
+			return endToday.AddDate(0, 0, 1), true, nil
+		case from > to && now < to:
+			return endToday, true, nil
+		}
+		return time.Time{}, false, nil
+	}
+	return time.Time{}, false, fmt.Errorf("Unknown blackout kind %q", b.Kind)
+}
+
+// BlackoutCalendar checks the blackout rules of a fact category, along with the rules for every category
+// It satisfies scheduler.Blackout
+type BlackoutCalendar struct {
+	DB       *gorm.DB
+	Category string // Empty to check only the rules for every category
+}
+
+// BlackedOut returns when the blackout covering t ends and why, or the zero time if no rule covers t
+// When rules overlap the latest end is returned
+func (c *BlackoutCalendar) BlackedOut(t time.Time) (time.Time, string, error) {
+	rules := []BlackoutRule{}
+	if err := c.DB.Where("category = ? OR category = ?", "", c.Category).Find(&rules).Error; err != nil {
+		return time.Time{}, "", err
+	}
+
+	var until time.Time
+	var reason string
+	for _, rule := range rules {
+		end, ok, err := rule.Covers(t)
+		if err != nil {
+			return time.Time{}, "", fmt.Errorf("Blackout rule %v is invalid: %v", rule.ID, err)
+		}
+		if ok && end.After(until) {
+			until, reason = end, rule.String()
+		}
+	}
+	return until, reason, nil
+}
+
+// ListBlackoutRules returns every blackout rule, oldest first
+func ListBlackoutRules(db *gorm.DB) ([]BlackoutRule, error) {
+	rules := make([]BlackoutRule, 0)
+	if err := db.Order("id").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
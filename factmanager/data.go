@@ -1,6 +1,10 @@
 package factmanager
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 // CatEnthusiast represents users of CatFacts
 type CatEnthusiast struct {
@@ -10,8 +14,9 @@ type CatEnthusiast struct {
 	Active           bool   // Send facts to active user
 	FactCategory     string
 	SubscriptionID   uint
-	TotalSentSession int // Total messages sent to user during current subscription
-	TotalSent        int // Total messages sent to user over all time
+	TimeZone         string // IANA time zone such as "America/Vancouver", DefaultTimeZone if empty
+	TotalSentSession int    // Total messages sent to user during current subscription
+	TotalSent        int    // Total messages sent to user over all time
 }
 
 // Fact is a simple fact on any category, such as "cat"
@@ -55,7 +60,60 @@ type Category struct {
 type Subscription struct {
 	gorm.Model
 	Frequency       string `gorm:"unique"` // Descriptive name such as "daily" or "every fifteen minutes"
-	Description     string `gorm:"unique"` // Short description of the subscription
-	Cron            string `gorm:"unique"` // cron string, only ints and special characters *,- accepted
+	Description     string `gorm:"unique"` // Short description of the subscription, generated from Cron when saved
+	Cron            string `gorm:"unique"` // cron string, supports lists, ranges, steps, names and @ macros
+	WindowMinutes   int    // If set, each user is sent at their own random time within this many minutes of each cron time
+	JitterMinutes   int    // Random delay of up to this many minutes added to each send
+	StaggerSeconds  int    // Spreads the sends to a subscription's users over this many seconds
 	ThanksThreshold int    // Number of messages sent prior to beginning of say thanks hints
 }
+
+// JobState records scheduler job state that must survive restarts
+type JobState struct {
+	gorm.Model
+	JobID   string    `gorm:"unique"` // ID of the job in the scheduler
+	LastRun time.Time // Scheduled minute of the job's last successful run
+}
+
+// OneShotJob records a scheduler job that runs once and has yet to run
+type OneShotJob struct {
+	gorm.Model
+	JobID   string    `gorm:"unique"` // ID of the job in the scheduler
+	At      time.Time // When the job runs
+	Kind    string    // Kind of job, which decides what it does
+	Payload string    // Details of what the job does, such as who to text
+}
+
+// JobRun records a single run of a scheduler job
+type JobRun struct {
+	gorm.Model
+	JobID         string        `gorm:"index"` // ID of the job in the scheduler
+	ScheduledAt   time.Time     // Minute the run was scheduled for
+	StartedAt     time.Time     // When the run started
+	EndedAt       time.Time     // When the run ended
+	Duration      time.Duration // How long the run took
+	Outcome       string        // success, error, timed out or cancelled
+	Error         string        // Error text, empty on success
+	UsersMessaged int           // Number of users sent a fact during the run
+	UsersFailed   int           // Number of users whose send failed
+	UsersSkipped  int           // Number of users skipped as inactive or blacked out
+}
+
+// OutboundMessage is a text sent to a user, kept up to date by Twilio's delivery status callbacks
+type OutboundMessage struct {
+	gorm.Model
+	SID       string `gorm:"column:sid;uniqueIndex"` // Provider's ID of the message
+	UserID    uint   `gorm:"index"`                  // User the message was sent to, zero if the status arrived first
+	Status    string // Latest delivery status, such as queued, sent, delivered, undelivered or failed
+	ErrorCode string // Twilio error code of an undelivered or failed message
+}
+
+// BlackoutRule is a period when no facts are sent: daily quiet hours, a single date, or a date every year
+type BlackoutRule struct {
+	gorm.Model
+	Category string // Fact category the rule applies to, empty for every category
+	Kind     string // One of BlackoutQuiet, BlackoutDate or BlackoutYearly
+	Date     string // YYYY-MM-DD for date rules, MM-DD for yearly rules
+	Start    string // HH:MM quiet hours begin, for quiet rules
+	End      string // HH:MM quiet hours end, before Start if they span midnight
+}
@@ -0,0 +1,112 @@
+package factmanager
+
+import (
+	"fmt"
+	"sort"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// statusRanks orders delivery statuses so a callback that arrives late can't undo a newer status
+// Statuses not listed, such as queued, rank lowest
+var statusRanks = map[string]int{
+	"sending":     1,
+	"sent":        2,
+	"delivered":   3,
+	"undelivered": 3,
+	"failed":      3,
+	"canceled":    3,
+	"read":        4,
+}
+
+// RecordOutboundMessage saves a message sent to a user with the status the provider returned
+// If its status callback arrived first, the user is filled in and the newer status is kept
+func RecordOutboundMessage(db *gorm.DB, sid string, userID uint, status string) error {
+	msg := OutboundMessage{SID: sid, UserID: userID, Status: status}
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "sid"}},
+		DoUpdates: append(clause.AssignmentColumns([]string{"updated_at", "user_id"}), statusAssignment("status", status)),
+	}).Create(&msg).Error
+}
+
+// UpdateMessageStatus records a message's delivery status from a status callback
+// Statuses older than the one recorded are ignored, since callbacks may arrive out of order
+func UpdateMessageStatus(db *gorm.DB, sid, status, errorCode string) error {
+	msg := OutboundMessage{SID: sid, Status: status, ErrorCode: errorCode}
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "sid"}},
+		DoUpdates: append(clause.AssignmentColumns([]string{"updated_at"}), statusAssignment("status", status), statusAssignment("error_code", status)),
+	}).Create(&msg).Error
+}
+
+// newerStatuses returns the statuses that rank above status, which it must not replace
+func newerStatuses(status string) []string {
+	newer := make([]string, 0)
+	for s, rank := range statusRanks {
+		if rank > statusRanks[status] {
+			newer = append(newer, s)
+		}
+	}
+	sort.Strings(newer)
+	return newer
+}
+
+// statusAssignment sets a column of a conflicting message to the inserted value,
+// unless the message already has a status newer than status
+func statusAssignment(column, status string) clause.Assignment {
+	inserted := clause.Column{Table: "excluded", Name: column}
+	newer := newerStatuses(status)
+	if len(newer) == 0 {
+		return clause.Assignment{Column: clause.Column{Name: column}, Value: inserted}
+	}
+	current := clause.Column{Table: clause.CurrentTable, Name: column}
+	recorded := clause.Column{Table: clause.CurrentTable, Name: "status"}
+	return clause.Assignment{Column: clause.Column{Name: column}, Value: gorm.Expr("CASE WHEN ? IN ? THEN ? ELSE ? END", recorded, newer, current, inserted)}
+}
+
+// DeliveryStats counts the outcomes of the messages sent to a user
+type DeliveryStats struct {
+	Delivered int // Messages delivered or read
+	Failed    int // Messages undelivered, failed or canceled
+	Pending   int // Messages without a final status yet
+}
+
+// Rate returns the percentage of finished messages that were delivered, zero if none have finished
+func (d DeliveryStats) Rate() float64 {
+	if d.Delivered+d.Failed == 0 {
+		return 0
+	}
+	return 100 * float64(d.Delivered) / float64(d.Delivered+d.Failed)
+}
+
+// String describes the stats, such as "95% delivered (38 of 40), 1 pending"
+func (d DeliveryStats) String() string {
+	if d.Delivered+d.Failed == 0 {
+		return fmt.Sprintf("none delivered yet, %v pending", d.Pending)
+	}
+	return fmt.Sprintf("%.0f%% delivered (%v of %v), %v pending", d.Rate(), d.Delivered, d.Delivered+d.Failed, d.Pending)
+}
+
+// UserDeliveryStats counts the outcomes of the messages sent to a user
+func UserDeliveryStats(db *gorm.DB, userID uint) (DeliveryStats, error) {
+	counts := []struct {
+		Status string
+		Count  int
+	}{}
+	if err := db.Model(&OutboundMessage{}).Select("status, count(*) as count").Where("user_id = ?", userID).Group("status").Scan(&counts).Error; err != nil {
+		return DeliveryStats{}, err
+	}
+	stats := DeliveryStats{}
+	for _, c := range counts {
+		switch c.Status {
+		case "delivered", "read":
+			stats.Delivered += c.Count
+		case "undelivered", "failed", "canceled":
+			stats.Failed += c.Count
+		default:
+			stats.Pending += c.Count
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,112 @@
+package factmanager
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// dryRunDB makes a database that runs no SQL, each statement it would have run is added to statements
+func dryRunDB(t *testing.T, statements *[]string) *gorm.DB {
+	conn, err := sql.Open("pgx", "")
+	if err != nil {
+		t.Fatalf("Error opening dry run database: %v", err)
+	}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("Error opening dry run database: %v", err)
+	}
+	db.Callback().Create().After("gorm:create").Register("test:record", func(tx *gorm.DB) {
+		*statements = append(*statements, tx.Dialector.Explain(tx.Statement.SQL.String(), tx.Statement.Vars...))
+	})
+	return db
+}
+
+func TestOutOfOrderStatuses(t *testing.T) {
+	tests := []struct {
+		statuses []string
+		want     string
+	}{
+		{[]string{"queued", "sending", "sent", "delivered"}, "delivered"},
+		{[]string{"queued", "delivered", "sent"}, "delivered"},
+		{[]string{"sent", "sending", "queued"}, "sent"},
+		{[]string{"failed", "sent"}, "failed"},
+		{[]string{"delivered", "read", "delivered"}, "read"},
+		{[]string{"read", "queued"}, "read"},
+		// Final statuses rank the same, so the latest one wins
+		{[]string{"delivered", "undelivered"}, "undelivered"},
+		{[]string{"queued", "accepted"}, "accepted"},
+	}
+
+	for _, test := range tests {
+		// Each status is applied the way the upsert's CASE does, keeping a recorded status that is newer
+		recorded := ""
+		for _, status := range test.statuses {
+			kept := false
+			for _, newer := range newerStatuses(status) {
+				kept = kept || newer == recorded
+			}
+			if !kept {
+				recorded = status
+			}
+		}
+		if recorded != test.want {
+			t.Errorf("statuses %v recorded %q, want %q", test.statuses, recorded, test.want)
+		}
+	}
+}
+
+func TestMessageUpserts(t *testing.T) {
+	statements := make([]string, 0)
+	db := dryRunDB(t, &statements)
+
+	if err := UpdateMessageStatus(db, "SM123", "sent", ""); err != nil {
+		t.Fatalf("UpdateMessageStatus returned error %v", err)
+	}
+	if err := RecordOutboundMessage(db, "SM123", 7, "queued"); err != nil {
+		t.Fatalf("RecordOutboundMessage returned error %v", err)
+	}
+	if err := UpdateMessageStatus(db, "SM123", "read", ""); err != nil {
+		t.Fatalf("UpdateMessageStatus returned error %v", err)
+	}
+	if len(statements) != 3 {
+		t.Fatalf("ran %v statements, want 3: %v", len(statements), statements)
+	}
+	tests := []struct {
+		name     string
+		contains []string
+		lacks    []string
+	}{
+		{
+			"status callback",
+			[]string{`ON CONFLICT ("sid") DO UPDATE SET`, `"status"=CASE WHEN "outbound_messages"."status" IN ('canceled','delivered','failed','read','undelivered') THEN "outbound_messages"."status" ELSE "excluded"."status" END`},
+			[]string{`"user_id"=`},
+		},
+		{
+			"sent message",
+			[]string{`ON CONFLICT ("sid") DO UPDATE SET`, `"user_id"="excluded"."user_id"`, `IN ('canceled','delivered','failed','read','sending','sent','undelivered') THEN "outbound_messages"."status"`},
+			[]string{`"error_code"=`},
+		},
+		{
+			"newest status",
+			[]string{`ON CONFLICT ("sid") DO UPDATE SET`, `"status"="excluded"."status","error_code"="excluded"."error_code"`},
+			[]string{"CASE"},
+		},
+	}
+	for i, test := range tests {
+		for _, want := range test.contains {
+			if !strings.Contains(statements[i], want) {
+				t.Errorf("%v ran %v, missing %v", test.name, statements[i], want)
+			}
+		}
+		for _, unwanted := range test.lacks {
+			if strings.Contains(statements[i], unwanted) {
+				t.Errorf("%v ran %v, which shouldn't contain %v", test.name, statements[i], unwanted)
+			}
+		}
+	}
+}
@@ -74,7 +74,7 @@ func MakeReplyMessage(category string, db *gorm.DB) string {
 
 // Init establishes a postgresql database connection
 func Init(host, user, pass, name, port string) (*gorm.DB, error) {
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=America/Toronto", host, user, pass, name, port)
+	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=%s", host, user, pass, name, port, DefaultTimeZone)
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
 	if err != nil {
 		return nil, err
@@ -88,6 +88,11 @@ func Init(host, user, pass, name, port string) (*gorm.DB, error) {
 	db.AutoMigrate(&ThanksMessage{})
 	db.AutoMigrate(&ReplyMessage{})
 	db.AutoMigrate(&CatEnthusiast{})
+	db.AutoMigrate(&JobState{})
+	db.AutoMigrate(&JobRun{})
+	db.AutoMigrate(&OneShotJob{})
+	db.AutoMigrate(&BlackoutRule{})
+	db.AutoMigrate(&OutboundMessage{})
 
 	return db, nil
 }
@@ -102,6 +107,11 @@ func Reset(db *gorm.DB) {
 	db.Migrator().DropTable(&CatEnthusiast{})
 	db.Migrator().DropTable(&Subscription{})
 	db.Migrator().DropTable(&Category{})
+	db.Migrator().DropTable(&JobState{})
+	db.Migrator().DropTable(&JobRun{})
+	db.Migrator().DropTable(&OneShotJob{})
+	db.Migrator().DropTable(&BlackoutRule{})
+	db.Migrator().DropTable(&OutboundMessage{})
 
 	db.Migrator().CreateTable(&Greeting{})
 	db.Migrator().CreateTable(&Fact{})
@@ -110,6 +120,11 @@ func Reset(db *gorm.DB) {
 	db.Migrator().CreateTable(&CatEnthusiast{})
 	db.Migrator().CreateTable(&Category{})
 	db.Migrator().CreateTable(&Subscription{})
+	db.Migrator().CreateTable(&JobState{})
+	db.Migrator().CreateTable(&JobRun{})
+	db.Migrator().CreateTable(&OneShotJob{})
+	db.Migrator().CreateTable(&BlackoutRule{})
+	db.Migrator().CreateTable(&OutboundMessage{})
 }
 
 // Populate populates them with default data about cats, you must provide your own csv
@@ -190,26 +205,27 @@ func Populate(db *gorm.DB, categoryName, factCSV string) error {
 	subscriptions := []Subscription{
 		{
 			Frequency:       "every fifteen minutes",
-			Description:     "Will send at X:00, X:15, X:30, and X:45 between 9am and 10pm",
-			Cron:            "0,15,30,45 9-21 * * *",
+			Cron:            "*/15 9-21 * * *",
+			JitterMinutes:   5,
+			StaggerSeconds:  30,
 			ThanksThreshold: 10,
 		},
 		{
 			Frequency:       "hourly",
-			Description:     "Will send every hour on the hour between 9am and 10pm",
 			Cron:            "0 9-21 * * *",
+			WindowMinutes:   60,
 			ThanksThreshold: 10,
 		},
 		{
 			Frequency:       "daily",
-			Description:     "Will send every day at 10:10am",
-			Cron:            "10 10 * * *",
+			Cron:            "0 9 * * *",
+			WindowMinutes:   12 * 60,
 			ThanksThreshold: 10,
 		},
 		{
 			Frequency:       "weekly",
-			Description:     "Will send every Monday at 10:10am",
-			Cron:            "10 10 * * 1",
+			Cron:            "0 9 * * mon",
+			WindowMinutes:   12 * 60,
 			ThanksThreshold: 10,
 		},
 	}
@@ -0,0 +1,92 @@
+package factmanager
+
+import (
+	"errors"
+	"time"
+
+	"github.com/mdesson/CatFactsForever/scheduler"
+	"gorm.io/gorm"
+)
+
+// JobStore persists scheduler job state, run history and one-shot jobs in postgres
+// It satisfies scheduler.Store, scheduler.History and scheduler.OneShotStore
+type JobStore struct {
+	DB *gorm.DB
+}
+
+// LastRun returns the scheduled minute of the job's last successful run, or the zero time if there is none
+func (s *JobStore) LastRun(id string) (time.Time, error) {
+	state := JobState{}
+	if err := s.DB.Where("job_id = ?", id).First(&state).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	return state.LastRun, nil
+}
+
+// SaveLastRun records the scheduled minute of the job's last successful run
+func (s *JobStore) SaveLastRun(id string, scheduled time.Time) error {
+	state := JobState{}
+	return s.DB.Where(JobState{JobID: id}).Assign(JobState{LastRun: scheduled}).FirstOrCreate(&state).Error
+}
+
+// RecordRun saves a finished run of a job
+func (s *JobStore) RecordRun(run scheduler.Run) error {
+	jobRun := &JobRun{
+		JobID:         run.JobID,
+		ScheduledAt:   run.Scheduled,
+		StartedAt:     run.Start,
+		EndedAt:       run.End,
+		Duration:      run.Duration(),
+		Outcome:       string(run.Outcome),
+		UsersMessaged: run.Count,
+		UsersFailed:   run.Tasks.Failed,
+		UsersSkipped:  run.Tasks.Skipped,
+	}
+	if run.Err != nil {
+		jobRun.Error = run.Err.Error()
+	}
+	return s.DB.Create(jobRun).Error
+}
+
+// SaveOneShot records a one-shot job that has yet to run
+func (s *JobStore) SaveOneShot(o scheduler.OneShot) error {
+	job := &OneShotJob{JobID: o.ID, At: o.At, Kind: o.Kind, Payload: o.Payload}
+	return s.DB.Create(job).Error
+}
+
+// DeleteOneShot permanently deletes a one-shot job so its ID can be used again
+func (s *JobStore) DeleteOneShot(id string) error {
+	return s.DB.Unscoped().Where("job_id = ?", id).Delete(&OneShotJob{}).Error
+}
+
+// OneShots returns every one-shot job that has yet to run
+func (s *JobStore) OneShots() ([]scheduler.OneShot, error) {
+	jobs := []OneShotJob{}
+	if err := s.DB.Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	oneShots := make([]scheduler.OneShot, 0, len(jobs))
+	for _, job := range jobs {
+		oneShots = append(oneShots, scheduler.OneShot{ID: job.JobID, At: job.At, Kind: job.Kind, Payload: job.Payload})
+	}
+	return oneShots, nil
+}
+
+// RecentJobRuns returns up to limit of the job's most recent runs, newest first
+func RecentJobRuns(db *gorm.DB, jobID string, limit int) ([]JobRun, error) {
+	runs := make([]JobRun, 0)
+	if err := db.Where("job_id = ?", jobID).Order("scheduled_at desc").Limit(limit).Find(&runs).Error; err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// PruneJobRuns permanently deletes runs scheduled before the given time
+// Returns the number of runs deleted
+func PruneJobRuns(db *gorm.DB, before time.Time) (int64, error) {
+	result := db.Unscoped().Where("scheduled_at < ?", before).Delete(&JobRun{})
+	return result.RowsAffected, result.Error
+}
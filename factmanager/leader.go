@@ -0,0 +1,78 @@
+package factmanager
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// AdvisoryLock elects a leader among replicas sharing a postgres database with a session advisory lock
+// The lock is held on a dedicated connection, so postgres releases it if the leader dies or loses its connection
+// It satisfies scheduler.Leader
+type AdvisoryLock struct {
+	DB      *gorm.DB
+	Key     int64      // Lock key, every replica must use the same key
+	mu      sync.Mutex // Guards conn and leading
+	conn    *sql.Conn  // Connection holding or trying for the lock
+	leading bool       // If conn holds the lock
+}
+
+// Lead tries to take the lock, or checks that the connection holding it is still alive
+func (l *AdvisoryLock) Lead() (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ctx := context.Background()
+
+	if l.conn == nil {
+		sqlDB, err := l.DB.DB()
+		if err != nil {
+			return false, err
+		}
+		if l.conn, err = sqlDB.Conn(ctx); err != nil {
+			l.conn = nil
+			return false, err
+		}
+	}
+
+	// The lock lasts as long as the connection, so a live connection means we still lead
+	if l.leading {
+		if err := l.conn.PingContext(ctx); err != nil {
+			l.reset()
+			return false, err
+		}
+		return true, nil
+	}
+
+	if err := l.conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", l.Key).Scan(&l.leading); err != nil {
+		l.reset()
+		return false, err
+	}
+	return l.leading, nil
+}
+
+// Resign releases the lock so another replica can take over
+func (l *AdvisoryLock) Resign() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn == nil {
+		return nil
+	}
+	defer l.reset()
+	if !l.leading {
+		return nil
+	}
+	_, err := l.conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", l.Key)
+	return err
+}
+
+// reset discards the connection, which releases the lock if it is still held. Must hold l.mu
+// The connection is closed rather than returned to the pool so the lock can never outlive it there
+func (l *AdvisoryLock) reset() {
+	l.conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	l.conn.Close()
+	l.conn = nil
+	l.leading = false
+}
@@ -0,0 +1,46 @@
+package factmanager
+
+import (
+	"fmt"
+
+	"github.com/mdesson/CatFactsForever/scheduler"
+	"gorm.io/gorm"
+)
+
+// Schedule describes in English when the subscription sends, generated from its Cron, window and jitter
+func (s Subscription) Schedule() (string, error) {
+	schedule, err := scheduler.Describe(s.Cron)
+	if err != nil {
+		return "", err
+	}
+	if s.WindowMinutes > 0 {
+		schedule = fmt.Sprintf("%v, at a random time up to %v later", schedule, minutesText(s.WindowMinutes))
+	}
+	if s.JitterMinutes > 0 {
+		schedule = fmt.Sprintf("%v, up to %v late", schedule, minutesText(s.JitterMinutes))
+	}
+	return schedule, nil
+}
+
+// BeforeSave rejects invalid cron strings and regenerates the description so it can't drift from the Cron
+func (s *Subscription) BeforeSave(tx *gorm.DB) error {
+	schedule, err := s.Schedule()
+	if err != nil {
+		return fmt.Errorf("Invalid cron string for subscription %v: %v", s.Frequency, err)
+	}
+	s.Description = "Will send " + schedule
+	return nil
+}
+
+// minutesText formats a number of minutes as "5 minutes", "1 hour" or "12 hours"
+func minutesText(minutes int) string {
+	switch {
+	case minutes == 1:
+		return "1 minute"
+	case minutes == 60:
+		return "1 hour"
+	case minutes%60 == 0:
+		return fmt.Sprintf("%v hours", minutes/60)
+	}
+	return fmt.Sprintf("%v minutes", minutes)
+}
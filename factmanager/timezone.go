@@ -0,0 +1,104 @@
+package factmanager
+
+import (
+	"archive/zip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTimeZone is the IANA time zone of the database session, and of users who haven't set their own
+var DefaultTimeZone = "America/Toronto"
+
+// LoadTimeZone loads an IANA time zone such as "America/Vancouver", the empty string loads DefaultTimeZone
+// Admin commands are lower cased, so names are also matched regardless of case against the zone files
+func LoadTimeZone(name string) (*time.Location, error) {
+	if name == "" {
+		name = DefaultTimeZone
+	}
+	// time.LoadLocation treats "Local" as the server's zone, which is what user zones exist to avoid
+	if strings.EqualFold(name, "local") {
+		return nil, fmt.Errorf("Unknown time zone %v", name)
+	}
+	for _, candidate := range []string{name, properZone(name), strings.ToUpper(name)} {
+		if candidate == "" {
+			continue
+		}
+		if loc, err := time.LoadLocation(candidate); err == nil {
+			return loc, nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown time zone %v", name)
+}
+
+// zoneDirs are the directories time.LoadLocation looks for zone files in, zone names are listed from them
+var zoneDirs = []string{"/usr/share/zoneinfo/", "/usr/share/lib/zoneinfo/", "/usr/lib/locale/TZ/", "/etc/zoneinfo/"}
+
+// zoneNames maps lower cased IANA time zone names to their proper names, loaded on first use
+var zoneNames struct {
+	once    sync.Once
+	byLower map[string]string
+}
+
+// properZone returns the properly cased IANA name of a time zone typed in any case, such as "America/Port-au-Prince"
+// for "america/port-au-prince". Returns the empty string if the name isn't found in the zone files
+func properZone(name string) string {
+	zoneNames.once.Do(loadZoneNames)
+	return zoneNames.byLower[strings.ToLower(name)]
+}
+
+// loadZoneNames lists the zones of every zone directory and zone archive time.LoadLocation uses
+func loadZoneNames() {
+	zoneNames.byLower = make(map[string]string)
+	add := func(name string) {
+		if !strings.HasPrefix(name, "posix/") && !strings.HasPrefix(name, "right/") {
+			zoneNames.byLower[strings.ToLower(name)] = name
+		}
+	}
+
+	dirs := append([]string{}, zoneDirs...)
+	archives := []string{filepath.Join(runtime.GOROOT(), "lib", "time", "zoneinfo.zip")}
+	if zoneinfo := os.Getenv("ZONEINFO"); strings.HasSuffix(zoneinfo, ".zip") {
+		archives = append(archives, zoneinfo)
+	} else if zoneinfo != "" {
+		dirs = append(dirs, zoneinfo)
+	}
+
+	for _, dir := range dirs {
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				if rel, err := filepath.Rel(dir, path); err == nil {
+					add(filepath.ToSlash(rel))
+				}
+			}
+			return nil
+		})
+	}
+	for _, archive := range archives {
+		r, err := zip.OpenReader(archive)
+		if err != nil {
+			continue
+		}
+		for _, f := range r.File {
+			add(f.Name)
+		}
+		r.Close()
+	}
+}
+
+// Zone returns the user's IANA time zone, DefaultTimeZone if they haven't set one
+func (u CatEnthusiast) Zone() string {
+	if u.TimeZone == "" {
+		return DefaultTimeZone
+	}
+	return u.TimeZone
+}
+
+// Location loads the user's time zone
+func (u CatEnthusiast) Location() (*time.Location, error) {
+	return LoadTimeZone(u.TimeZone)
+}
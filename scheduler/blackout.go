@@ -0,0 +1,36 @@
+package scheduler
+
+import "time"
+
+// Blackout reports times when a job must not run, such as quiet hours or holidays
+// Implementations must be safe for concurrent use
+type Blackout interface {
+	// BlackedOut returns when the blackout covering t ends and why, or the zero time if t is not blacked out
+	BlackedOut(t time.Time) (until time.Time, reason string, err error)
+}
+
+// BlackoutPolicy decides what happens to a run that is due during a blackout
+type BlackoutPolicy int
+
+const (
+	// BlackoutSkip drops the run. This is the default
+	BlackoutSkip BlackoutPolicy = iota
+	// BlackoutDefer runs the job once the blackout ends, unless a newer run is due first
+	BlackoutDefer
+)
+
+// WithBlackout consults blackout before every run of the job, including retries and catch-up runs
+// Runs that fall in a blackout are skipped or deferred according to policy
+func WithBlackout(blackout Blackout, policy BlackoutPolicy) JobOption {
+	return func(j *Job) {
+		j.Blackout = blackout
+		j.BlackoutPolicy = policy
+	}
+}
+
+// suppression describes the most recent run a blackout stopped
+type suppression struct {
+	scheduled time.Time // Scheduled minute of the run
+	reason    string    // Why the blackout applies
+	until     time.Time // When a deferred run is due, zero if the run was skipped
+}
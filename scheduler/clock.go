@@ -0,0 +1,31 @@
+package scheduler
+
+import "time"
+
+// Clock provides the current time and timers to the scheduler
+// Replace it with a fake in tests to control time deterministically
+type Clock interface {
+	Now() time.Time                                         // Current time
+	After(d time.Duration) <-chan time.Time                 // Sends the current time once d has elapsed
+	AfterFunc(d time.Duration, f func()) (stop func() bool) // Calls f once d has elapsed unless stopped first
+}
+
+// realClock is a Clock backed by the time package
+type realClock struct{}
+
+// RealClock returns a Clock that uses the system time
+func RealClock() Clock {
+	return realClock{}
+}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) func() bool {
+	return time.AfterFunc(d, f).Stop
+}
@@ -0,0 +1,165 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// cronBounds describes the range of values and the names accepted by a cron field
+type cronBounds struct {
+	name  string         // Name of the field, used in error messages
+	min   int            // Smallest allowed value
+	max   int            // Largest allowed value
+	names map[string]int // Optional names such as "jan" or "mon"
+}
+
+var (
+	minuteBounds  = cronBounds{name: "minute", min: 0, max: 59}
+	hourBounds    = cronBounds{name: "hour", min: 0, max: 23}
+	domBounds     = cronBounds{name: "day of month", min: 1, max: 31}
+	monthBounds   = cronBounds{name: "month", min: 1, max: 12, names: monthNames}
+	weekdayBounds = cronBounds{name: "day of week", min: 0, max: 7, names: weekdayNames} // 0 and 7 are both Sunday
+)
+
+// fieldBounds holds the bounds of each of the five cron fields, in order
+var fieldBounds = []cronBounds{minuteBounds, hourBounds, domBounds, monthBounds, weekdayBounds}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var weekdayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// cronMacros maps the supported @ shortcuts to their five field equivalent
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// splitCron expands macros and splits a cron string into its five fields
+func splitCron(cron string) ([]string, error) {
+	cron = strings.TrimSpace(cron)
+	if strings.HasPrefix(cron, "@") {
+		expanded, ok := cronMacros[strings.ToLower(cron)]
+		if !ok {
+			return nil, fmt.Errorf("Unknown cron macro %q", cron)
+		}
+		cron = expanded
+	}
+
+	fields := strings.Fields(cron)
+
+	// Ensure correct number of fields in cron string
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("Invalid length of cron string")
+	}
+	return fields, nil
+}
+
+// isWildcard reports if a field or range matches every value
+func isWildcard(field string) bool {
+	return field == "*" || field == "?"
+}
+
+// isRestricted reports if a day field limits which days run, following cron's rule that
+// fields starting with a wildcard such as "*/2" are unrestricted
+func isRestricted(field string) bool {
+	return !strings.HasPrefix(field, "*") && !strings.HasPrefix(field, "?")
+}
+
+// parseCronField expands a cron field into a bitset where bit n is set if value n matches
+// Supports lists, ranges, steps, names and the wildcards '*' and '?'
+func parseCronField(input string, bounds cronBounds) (uint64, error) {
+	var values uint64
+	for _, part := range strings.Split(input, ",") {
+		partValues, err := parseCronPart(part, bounds)
+		if err != nil {
+			return 0, err
+		}
+		values |= partValues
+	}
+
+	// Sunday may be written as either 0 or 7
+	if bounds.name == weekdayBounds.name && values&(1<<7) != 0 {
+		values |= 1
+		values &^= 1 << 7
+	}
+	return values, nil
+}
+
+// parseCronPart expands a single element of a cron list, such as "5", "1-5", "*/15" or "mon-fri/2"
+func parseCronPart(part string, bounds cronBounds) (uint64, error) {
+	rangePart := part
+	step := 1
+
+	// Split off the step, if there is one
+	if i := strings.Index(part, "/"); i != -1 {
+		rangePart = part[:i]
+		var err error
+		step, err = strconv.Atoi(part[i+1:])
+		if err != nil || step <= 0 {
+			return 0, fmt.Errorf("Invalid step in %q", part)
+		}
+	}
+
+	var start, end int
+	switch {
+	case isWildcard(rangePart):
+		start, end = bounds.min, bounds.max
+	case strings.Contains(rangePart, "-"):
+		fieldRange := strings.Split(rangePart, "-")
+		if len(fieldRange) != 2 {
+			return 0, fmt.Errorf("Invalid range %q", rangePart)
+		}
+		var err error
+		if start, err = parseCronValue(fieldRange[0], bounds); err != nil {
+			return 0, err
+		}
+		if end, err = parseCronValue(fieldRange[1], bounds); err != nil {
+			return 0, err
+		}
+		if start > end {
+			return 0, fmt.Errorf("Range start is after range end in %q", rangePart)
+		}
+	default:
+		var err error
+		if start, err = parseCronValue(rangePart, bounds); err != nil {
+			return 0, err
+		}
+		// A single value with a step such as "5/15" runs from that value to the maximum
+		end = start
+		if strings.Contains(part, "/") {
+			end = bounds.max
+		}
+	}
+
+	var values uint64
+	for v := start; v <= end; v += step {
+		values |= 1 << uint(v)
+	}
+	return values, nil
+}
+
+// parseCronValue converts a single number or name into its value and checks its bounds
+func parseCronValue(input string, bounds cronBounds) (int, error) {
+	if v, ok := bounds.names[strings.ToLower(input)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(input)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid value %q", input)
+	}
+	if v < bounds.min || v > bounds.max {
+		return 0, fmt.Errorf("Value %v out of range %v-%v", v, bounds.min, bounds.max)
+	}
+	return v, nil
+}
@@ -0,0 +1,241 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// dowBounds are the day of week values left once Sunday is folded into 0
+var dowBounds = cronBounds{name: "day of week", min: 0, max: 6}
+
+// Describe parses a cron expression and renders it in English
+func Describe(cron string) (string, error) {
+	s, err := ParseSchedule(cron)
+	if err != nil {
+		return "", err
+	}
+	return s.Describe(), nil
+}
+
+// Describe renders the schedule in English, such as
+// "at minutes 0, 15, 30 and 45 past every hour from 9 AM through 9 PM"
+func (s *Schedule) Describe() string {
+	days := bitValues(s.dom, domBounds)
+	months := bitValues(s.month, monthBounds)
+	weekdays := bitValues(s.weekday, dowBounds)
+
+	// A single date reads best as "on January 1"
+	if len(days) == 1 && len(months) == 1 && len(weekdays) == 7 {
+		return fmt.Sprintf("%v on %v %v", s.describeTime(), monthName(months[0]), days[0])
+	}
+
+	parts := []string{s.describeTime()}
+	if dayPhrase := s.describeDays(days, weekdays); dayPhrase != "" {
+		parts = append(parts, dayPhrase)
+	}
+	if len(months) != 12 {
+		parts = append(parts, "in "+listValues(months, monthName))
+	}
+	return strings.Join(parts, " ")
+}
+
+// describeTime renders the minute and hour fields
+func (s *Schedule) describeTime() string {
+	minutes := bitValues(s.minute, minuteBounds)
+	hours := bitValues(s.hour, hourBounds)
+	allMinutes := len(minutes) == 60
+	allHours := len(hours) == 24
+
+	// A handful of times reads best as a list of clock times
+	if !allMinutes && !allHours && step(minutes) == 0 && len(minutes)*len(hours) <= 4 {
+		times := make([]string, 0, len(minutes)*len(hours))
+		for _, h := range hours {
+			for _, m := range minutes {
+				times = append(times, clockTime(h, m))
+			}
+		}
+		return "at " + joinList(times)
+	}
+
+	var minutePhrase string
+	switch {
+	case allMinutes:
+		minutePhrase = "every minute"
+	case step(minutes) != 0:
+		minutePhrase = fmt.Sprintf("every %v minutes", step(minutes))
+		if minutes[0] != 0 {
+			minutePhrase = fmt.Sprintf("%v starting at minute %v", minutePhrase, minutes[0])
+		}
+	default:
+		minutePhrase = fmt.Sprintf("at %v %v", plural("minute", len(minutes)), listValues(minutes, itoa))
+	}
+
+	hourList := step(hours) == 0 && !isRange(hours)
+	switch {
+	case allHours && (allMinutes || step(minutes) != 0):
+		return minutePhrase
+	case allHours:
+		return minutePhrase + " past every hour"
+	case allMinutes || step(minutes) != 0:
+		if hourList {
+			return fmt.Sprintf("%v of the %v %v", minutePhrase, listValues(hours, hourName), plural("hour", len(hours)))
+		}
+		return fmt.Sprintf("%v of %v", minutePhrase, describeHours(hours))
+	case hourList:
+		return fmt.Sprintf("%v past %v", minutePhrase, listValues(hours, hourName))
+	default:
+		return fmt.Sprintf("%v past %v", minutePhrase, describeHours(hours))
+	}
+}
+
+// describeHours renders hours that form a single range or are evenly spaced
+func describeHours(hours []int) string {
+	first, last := hourName(hours[0]), hourName(hours[len(hours)-1])
+	n := step(hours)
+	switch {
+	case n == 0:
+		return fmt.Sprintf("every hour from %v through %v", first, last)
+	case hours[0] < n && hours[len(hours)-1]+n > hourBounds.max:
+		return fmt.Sprintf("every %v hours", n)
+	default:
+		return fmt.Sprintf("every %v hours from %v through %v", n, first, last)
+	}
+}
+
+// describeDays renders the day of month and day of week fields, following the rule that
+// a day runs if either field matches when both are restricted
+func (s *Schedule) describeDays(days, weekdays []int) string {
+	allDays := len(days) == 31
+	allWeekdays := len(weekdays) == 7
+
+	var dayPhrase string
+	if !allDays {
+		if n := step(days); n != 0 {
+			dayPhrase = fmt.Sprintf("on every %v day of the month", ordinal(n))
+			if days[0] != 1 {
+				dayPhrase = fmt.Sprintf("%v starting on day %v", dayPhrase, days[0])
+			}
+		} else {
+			dayPhrase = fmt.Sprintf("on %v %v of the month", plural("day", len(days)), listValues(days, itoa))
+		}
+	}
+	weekdayPhrase := "on " + listValues(weekdays, weekdayName)
+
+	switch {
+	case allDays && allWeekdays:
+		return ""
+	case allDays:
+		return weekdayPhrase
+	case allWeekdays:
+		return dayPhrase
+	case s.domRestricted && s.dowRestricted:
+		return fmt.Sprintf("%v or %v", dayPhrase, weekdayPhrase)
+	default:
+		return fmt.Sprintf("%v if it falls %v", dayPhrase, weekdayPhrase)
+	}
+}
+
+// bitValues returns the values set in a bitset within the bounds, in order
+func bitValues(bits uint64, bounds cronBounds) []int {
+	vals := make([]int, 0)
+	for n := bounds.min; n <= bounds.max; n++ {
+		if has(bits, n) {
+			vals = append(vals, n)
+		}
+	}
+	return vals
+}
+
+// step returns the spacing of more than four evenly spaced values, or 0 if there is none
+func step(vals []int) int {
+	if len(vals) <= 4 {
+		return 0
+	}
+	n := vals[1] - vals[0]
+	if n < 2 {
+		return 0
+	}
+	for i := 2; i < len(vals); i++ {
+		if vals[i]-vals[i-1] != n {
+			return 0
+		}
+	}
+	return n
+}
+
+// isRange reports if there are several values and they are consecutive
+func isRange(vals []int) bool {
+	return len(vals) > 1 && vals[len(vals)-1]-vals[0] == len(vals)-1
+}
+
+// listValues names each value, collapsing runs of three or more into "a through b"
+func listValues(vals []int, name func(int) string) string {
+	items := make([]string, 0, len(vals))
+	for i := 0; i < len(vals); {
+		j := i
+		for j+1 < len(vals) && vals[j+1] == vals[j]+1 {
+			j++
+		}
+		if j-i >= 2 {
+			items = append(items, fmt.Sprintf("%v through %v", name(vals[i]), name(vals[j])))
+		} else {
+			for k := i; k <= j; k++ {
+				items = append(items, name(vals[k]))
+			}
+		}
+		i = j + 1
+	}
+	return joinList(items)
+}
+
+// joinList joins items as "a", "a and b" or "a, b and c"
+func joinList(items []string) string {
+	if len(items) <= 1 {
+		return strings.Join(items, "")
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " and " + items[len(items)-1]
+}
+
+func plural(word string, n int) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
+
+func ordinal(n int) string {
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+		return fmt.Sprintf("%vth", n)
+	case n%10 == 1:
+		return fmt.Sprintf("%vst", n)
+	case n%10 == 2:
+		return fmt.Sprintf("%vnd", n)
+	case n%10 == 3:
+		return fmt.Sprintf("%vrd", n)
+	}
+	return fmt.Sprintf("%vth", n)
+}
+
+func itoa(n int) string {
+	return fmt.Sprint(n)
+}
+
+// clockTime formats an hour and minute as "9:05 AM"
+func clockTime(hour, minute int) string {
+	return time.Date(2000, 1, 1, hour, minute, 0, 0, time.UTC).Format("3:04 PM")
+}
+
+// hourName formats an hour as "9 AM"
+func hourName(hour int) string {
+	return time.Date(2000, 1, 1, hour, 0, 0, 0, time.UTC).Format("3 PM")
+}
+
+func monthName(month int) string {
+	return time.Month(month).String()
+}
+
+func weekdayName(day int) string {
+	return time.Weekday(day).String()
+}
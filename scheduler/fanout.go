@@ -0,0 +1,150 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Task is one independent piece of a run made with FanOut, such as sending a fact to one user
+type Task struct {
+	Name string                          // Identifies the task in the run's error, such as a user's name
+	Run  func(ctx context.Context) error // Returns ErrSkipped if there was nothing to do
+}
+
+// ErrSkipped is returned by a Task that had nothing to do, such as for an inactive user
+var ErrSkipped = errors.New("task skipped")
+
+// Summary counts the outcomes of the tasks of a run made with FanOut
+type Summary struct {
+	Succeeded int
+	Failed    int
+	Skipped   int
+}
+
+// Total returns the number of tasks in the run
+func (s Summary) Total() int {
+	return s.Succeeded + s.Failed + s.Skipped
+}
+
+// String describes the summary, such as "5 succeeded, 1 failed, 2 skipped"
+func (s Summary) String() string {
+	return fmt.Sprintf("%v succeeded, %v failed, %v skipped", s.Succeeded, s.Failed, s.Skipped)
+}
+
+// WithStagger spreads the starts of the tasks of each FanOut run evenly over d, so they don't all start at once
+// d should be well within the job's timeout
+func WithStagger(d time.Duration) JobOption {
+	return func(j *Job) {
+		j.Stagger = d
+	}
+}
+
+// FanOut makes a JobFunc that runs each of the tasks listed for a run concurrently and on its own,
+// so a task that fails doesn't stop the others
+// The run fails with the errors of every failed task, and its Summary is shown in the job's status
+// Succeeded tasks are added to the run's count
+func FanOut(list func(ctx context.Context) ([]Task, error)) JobFunc {
+	return func(ctx context.Context) error {
+		tasks, err := list(ctx)
+		if err != nil {
+			return err
+		}
+		stats, _ := ctx.Value(taskStatsKey{}).(*taskStats)
+		if stats == nil {
+			stats = &taskStats{}
+		}
+		job, _ := ctx.Value(jobKey{}).(*Job)
+		if job == nil {
+			job = &Job{clock: RealClock()}
+		}
+
+		var wg sync.WaitGroup
+		errs := make([]error, len(tasks))
+		for i, task := range tasks {
+			// Tasks start a fraction of the stagger apart, those that never start because the run ended fail with its error
+			gap := job.Stagger / time.Duration(len(tasks))
+			if i == 0 {
+				gap = 0
+			}
+			if err := waitStagger(ctx, job.clock, gap); err != nil {
+				errs[i] = err
+				atomic.AddInt64(&stats.failed, 1)
+				continue
+			}
+			wg.Add(1)
+			go func(i int, task Task) {
+				defer wg.Done()
+				switch err := job.runTask(ctx, task); {
+				case err == nil:
+					atomic.AddInt64(&stats.succeeded, 1)
+					AddCount(ctx, 1)
+				case errors.Is(err, ErrSkipped):
+					atomic.AddInt64(&stats.skipped, 1)
+				default:
+					errs[i] = err
+					atomic.AddInt64(&stats.failed, 1)
+				}
+			}(i, task)
+		}
+		wg.Wait()
+
+		failures := make([]string, 0)
+		for i, err := range errs {
+			if err != nil {
+				failures = append(failures, fmt.Sprintf("%v: %v", tasks[i].Name, err))
+			}
+		}
+		if len(failures) > 0 {
+			return fmt.Errorf("%v of %v tasks failed: %v", len(failures), len(tasks), strings.Join(failures, "; "))
+		}
+		return nil
+	}
+}
+
+// runTask runs one task of a FanOut run, turning a panic into an error wrapping ErrPanic
+func (j *Job) runTask(ctx context.Context, task Task) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			j.health.panicked(r)
+			err = recovered(fmt.Sprintf("task %v of job %v", task.Name, j.ID), r)
+		}
+	}()
+	return task.Run(ctx)
+}
+
+// waitStagger waits d on the job's clock before a task starts, returning early with the context's error if the run ends
+func waitStagger(ctx context.Context, clock Clock, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	select {
+	case <-clock.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// taskStats counts task outcomes while a FanOut run is going
+type taskStats struct {
+	succeeded, failed, skipped int64
+}
+
+func (s *taskStats) summary() Summary {
+	return Summary{
+		Succeeded: int(atomic.LoadInt64(&s.succeeded)),
+		Failed:    int(atomic.LoadInt64(&s.failed)),
+		Skipped:   int(atomic.LoadInt64(&s.skipped)),
+	}
+}
+
+// taskStatsKey is the context key holding the run's task outcomes
+type taskStatsKey struct{}
+
+// jobKey is the context key holding the job a run belongs to
+type jobKey struct{}
@@ -0,0 +1,110 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFanOut(t *testing.T) {
+	clock := newFakeClock(time.Date(2021, time.January, 4, 10, 10, 0, 0, time.UTC))
+	history := &memHistory{}
+	s := New(clock, WithHistory(history))
+
+	var mu sync.Mutex
+	sent := make([]string, 0)
+	send := func(name string, err error) Task {
+		return Task{Name: name, Run: func(ctx context.Context) error {
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			sent = append(sent, name)
+			return nil
+		}}
+	}
+	s.AddJob("1", "* * * * *", "", true, FanOut(func(ctx context.Context) ([]Task, error) {
+		return []Task{
+			send("florence", nil),
+			send("bad number", errors.New("invalid phone number")),
+			send("inactive", ErrSkipped),
+			send("garfield", nil),
+		}, nil
+	}))
+	runNow(s)
+
+	// One failed send doesn't stop the others
+	if len(sent) != 2 {
+		t.Errorf("sent to %v, want florence and garfield", sent)
+	}
+	job, _ := s.FindJob("1")
+	if status := job.Status(); !strings.Contains(status, "Last run's tasks: 2 succeeded, 1 failed, 1 skipped") {
+		t.Errorf("Status() = %q, want the task summary", status)
+	}
+	history.mu.Lock()
+	defer history.mu.Unlock()
+	if len(history.runs) != 1 {
+		t.Fatalf("recorded %v runs, want 1", len(history.runs))
+	}
+	run := history.runs[0]
+	if run.Count != 2 || run.Tasks != (Summary{Succeeded: 2, Failed: 1, Skipped: 1}) {
+		t.Errorf("recorded run %+v, want 2 sent, 1 failed and 1 skipped", run)
+	}
+	if run.Err == nil || !strings.Contains(run.Err.Error(), "bad number: invalid phone number") {
+		t.Errorf("run failed with %v, want the failed task's error", run.Err)
+	}
+}
+
+func TestFanOutStagger(t *testing.T) {
+	now := time.Date(2021, time.January, 4, 10, 10, 0, 0, time.UTC)
+	clock := newFakeClock(now)
+	s := New(clock)
+
+	starts := make(chan time.Time, 3)
+	task := Task{Name: "task", Run: func(ctx context.Context) error {
+		starts <- clock.Now()
+		return nil
+	}}
+	stagger := 90 * time.Second
+	s.AddJob("1", "* * * * *", "", true, FanOut(func(ctx context.Context) ([]Task, error) {
+		return []Task{task, task, task}, nil
+	}), WithStagger(stagger))
+	done := make(chan struct{})
+	go func() {
+		runNow(s)
+		close(done)
+	}()
+
+	// The tasks start a third of the stagger apart on the scheduler's clock
+	for i := 0; i < 3; i++ {
+		if i == 2 {
+			// A timer past the last task lets Advance return once it has started
+			clock.After(time.Hour)
+		}
+		if i > 0 {
+			advanced := make(chan struct{})
+			go func() {
+				clock.Advance(stagger / 3)
+				close(advanced)
+			}()
+			select {
+			case <-advanced:
+			case <-time.After(time.Second):
+				t.Fatalf("task %v isn't waiting on the scheduler's clock", i+1)
+			}
+		}
+		select {
+		case start := <-starts:
+			if want := now.Add(time.Duration(i) * stagger / 3); !start.Equal(want) {
+				t.Errorf("task %v started at %v, want %v", i+1, start, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("task %v didn't start", i+1)
+		}
+	}
+	<-done
+}
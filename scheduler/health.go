@@ -0,0 +1,182 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// StallTimeout is how long the scheduler loop may go without finishing a tick before it counts as stalled
+const StallTimeout = 3 * time.Minute
+
+// watchdogInterval is how often the watchdog checks the scheduler's health
+const watchdogInterval = time.Minute
+
+// ErrPanic is wrapped by the error of a run whose JobFunc panicked
+var ErrPanic = errors.New("job panicked")
+
+// Health describes the liveness of a scheduler
+type Health struct {
+	Running   bool      // Start has been called and Stop hasn't
+	Started   time.Time // When Start was called
+	LastTick  time.Time // When the scheduler loop last finished a tick, zero before the first
+	Stalled   bool      // The loop hasn't finished a tick for longer than StallTimeout
+	Panics    int       // Panics recovered from jobs and ticks since the scheduler was created
+	LastPanic string    // Value of the latest recovered panic
+	Skipped   int       // Minutes the loop missed, such as after a system sleep or the clock jumping forward
+	Repeated  int       // Ticks ignored because their minute was already evaluated, such as after the clock went back
+}
+
+// Healthy reports if the scheduler is running and its loop isn't stalled
+func (h Health) Healthy() bool {
+	return h.Running && !h.Stalled
+}
+
+// String describes the health in a few lines
+func (h Health) String() string {
+	var status string
+	switch {
+	case !h.Running:
+		status = "Scheduler is stopped"
+	case h.Stalled:
+		status = "Scheduler is STALLED"
+	default:
+		status = "Scheduler is running"
+	}
+	if h.LastTick.IsZero() {
+		status = fmt.Sprintf("%s, no ticks yet", status)
+	} else {
+		status = fmt.Sprintf("%s, last tick at %s", status, h.LastTick.Format("Mon Jan 2 15:04:05"))
+	}
+	if h.Panics > 0 {
+		status = fmt.Sprintf("%s\n%v panics recovered, last: %s", status, h.Panics, h.LastPanic)
+	}
+	if h.Skipped > 0 || h.Repeated > 0 {
+		status = fmt.Sprintf("%s\n%v minutes skipped, %v ticks repeated", status, h.Skipped, h.Repeated)
+	}
+	return status
+}
+
+// WithWatchdog checks the scheduler's health every minute while it is running
+// f is called when the scheduler loop stalls, and when panics were recovered since the last check
+func WithWatchdog(f func(Health)) Option {
+	return func(s *Scheduler) {
+		s.watchdog = f
+	}
+}
+
+// heartbeat records the liveness of the scheduler loop and the panics recovered from it and its jobs
+// It has its own lock so health can be checked while the scheduler is stuck holding its own
+type heartbeat struct {
+	mu        sync.Mutex
+	running   bool
+	started   time.Time
+	lastTick  time.Time
+	panics    int
+	lastPanic string
+	skips     int
+	repeats   int
+}
+
+// start records that the scheduler loop started at now
+func (b *heartbeat) start(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.running, b.started, b.lastTick = true, now, time.Time{}
+}
+
+// stop records that the scheduler loop stopped
+func (b *heartbeat) stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.running = false
+}
+
+// tick records that the scheduler loop finished a tick at now
+func (b *heartbeat) tick(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastTick = now
+}
+
+// panicked records a recovered panic
+func (b *heartbeat) panicked(value interface{}) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.panics++
+	b.lastPanic = fmt.Sprint(value)
+}
+
+// skipped records that the loop missed n minutes
+func (b *heartbeat) skipped(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.skips += n
+}
+
+// repeated records that the loop ignored a tick for a minute it already evaluated
+func (b *heartbeat) repeated() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.repeats++
+}
+
+// health describes the heartbeat as of now
+func (b *heartbeat) health(now time.Time) Health {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	last := b.lastTick
+	if last.IsZero() {
+		last = b.started
+	}
+	return Health{
+		Running:   b.running,
+		Started:   b.started,
+		LastTick:  b.lastTick,
+		Stalled:   b.running && now.Sub(last) > StallTimeout,
+		Panics:    b.panics,
+		LastPanic: b.lastPanic,
+		Skipped:   b.skips,
+		Repeated:  b.repeats,
+	}
+}
+
+// recovered logs a panic recovered from what with its stack, and returns it as an error wrapping ErrPanic
+// Must be called from the deferred function that recovered it so the stack is the panic's
+func recovered(what string, value interface{}) error {
+	log.Printf("Recovered panic in %v: %v\n%s", what, value, debug.Stack())
+	return fmt.Errorf("%w: %v", ErrPanic, value)
+}
+
+// Health reports whether the scheduler loop is alive, and the panics it recovered
+func (s *Scheduler) Health() Health {
+	return s.beat.health(s.clock.Now())
+}
+
+// watch calls the watchdog when the loop stalls or panics are recovered, until the scheduler stops
+func (s *Scheduler) watch() {
+	stalled, panics := false, s.Health().Panics
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.clock.After(watchdogInterval):
+		}
+		h := s.Health()
+		if (h.Stalled && !stalled) || h.Panics > panics {
+			s.watchdog(h)
+		}
+		stalled, panics = h.Stalled, h.Panics
+	}
+}
+
+// Liveness reports whether the default scheduler's loop is alive
+func Liveness() Health {
+	return defaultScheduler.Health()
+}
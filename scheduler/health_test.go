@@ -0,0 +1,126 @@
+package scheduler
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// hookLeader is a Leader that asks lead what to answer, counting calls from 1
+type hookLeader struct {
+	mu    sync.Mutex
+	calls int
+	lead  func(call int) bool
+}
+
+func (l *hookLeader) Lead() (bool, error) {
+	l.mu.Lock()
+	l.calls++
+	call := l.calls
+	l.mu.Unlock()
+	return l.lead(call), nil
+}
+
+func (l *hookLeader) Resign() error {
+	return nil
+}
+
+func TestJobPanicRecovered(t *testing.T) {
+	clock := newFakeClock(time.Date(2021, time.January, 4, 10, 10, 0, 0, time.UTC))
+	s := New(clock)
+	counter := &runCounter{runs: make(map[string][]time.Time)}
+	s.AddJob("panics", "* * * * *", "", true, func(ctx context.Context) error {
+		panic("assignment to entry in nil map")
+	})
+	s.AddJob("fine", "* * * * *", "", true, counter.jobFunc("fine"))
+	task := Task{Name: "florence", Run: func(ctx context.Context) error { return nil }}
+	s.AddJob("tasks", "* * * * *", "", true, FanOut(func(ctx context.Context) ([]Task, error) {
+		return []Task{task, {Name: "garfield", Run: func(ctx context.Context) error { panic("bad fact") }}, task}, nil
+	}))
+	runNow(s)
+
+	if got := counter.count("fine"); got != 1 {
+		t.Errorf("job alongside a panicking job ran %v times, want 1", got)
+	}
+	job, _ := s.FindJob("panics")
+	if status := job.Status(); !strings.Contains(status, "job panicked: assignment to entry in nil map") {
+		t.Errorf("Status() = %q, want the panic as the run's error", status)
+	}
+	job, _ = s.FindJob("tasks")
+	if status := job.Status(); !strings.Contains(status, "2 succeeded, 1 failed") || !strings.Contains(status, "garfield: job panicked: bad fact") {
+		t.Errorf("Status() = %q, want the panicking task to fail on its own", status)
+	}
+	if h := s.Health(); h.Panics != 2 {
+		t.Errorf("Health() counted %v panics, want 2", h.Panics)
+	}
+}
+
+func TestTickPanicRecovered(t *testing.T) {
+	start := time.Date(2021, time.January, 4, 10, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+	leader := &hookLeader{lead: func(call int) bool {
+		if call == 2 {
+			panic("lost the database connection")
+		}
+		return true
+	}}
+	s := New(clock, WithLeader(leader))
+	counter := &runCounter{runs: make(map[string][]time.Time)}
+	s.AddJob("1", "* * * * *", "", true, counter.jobFunc("1"))
+
+	clock.settle = s.wg.Wait
+	go s.Start()
+	clock.Advance(3 * time.Minute)
+	h := s.Health()
+	s.Stop()
+
+	// The first tick panicked, the loop carried on with the next two
+	if got := counter.count("1"); got != 2 {
+		t.Errorf("job ran %v times, want 2", got)
+	}
+	if !h.Healthy() || h.Panics != 1 || h.LastPanic != "lost the database connection" {
+		t.Errorf("Health() = %+v, want healthy with one panic", h)
+	}
+	if want := start.Add(3 * time.Minute); !h.LastTick.Equal(want) {
+		t.Errorf("LastTick = %v, want %v", h.LastTick, want)
+	}
+	if s.Health().Running {
+		t.Errorf("Health() reports running after Stop")
+	}
+}
+
+func TestWatchdogStall(t *testing.T) {
+	start := time.Date(2021, time.January, 4, 10, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+	release := make(chan struct{})
+	leader := &hookLeader{lead: func(call int) bool {
+		if call == 2 {
+			<-release
+		}
+		return true
+	}}
+	var mu sync.Mutex
+	reports := make([]Health, 0)
+	s := New(clock, WithLeader(leader), WithWatchdog(func(h Health) {
+		mu.Lock()
+		defer mu.Unlock()
+		reports = append(reports, h)
+	}))
+
+	go s.Start()
+	clock.Advance(6 * time.Minute)
+	h := s.Health()
+	close(release)
+	s.Stop()
+
+	if h.Healthy() || !h.Stalled || !strings.Contains(h.String(), "STALLED") {
+		t.Errorf("Health() = %+v, want stalled", h)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reports) != 1 || !reports[0].Stalled {
+		t.Errorf("watchdog reported %+v, want one stall", reports)
+	}
+}
@@ -2,158 +2,748 @@ package scheduler
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"strconv"
-	"strings"
+	"hash/fnv"
+	"log"
+	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // JobFunc will be the function run the job runner
+// It should return promptly once its context is done
 type JobFunc func(context.Context) error
 
+// JobOption configures optional behaviour of a job when it is added to a scheduler
+type JobOption func(*Job)
+
+// WithTimeout limits each run of the job to d
+// Runs still going after d have their context cancelled and are reported as timed out
+func WithTimeout(d time.Duration) JobOption {
+	return func(j *Job) {
+		j.Timeout = d
+	}
+}
+
+// WithOverlap sets what happens when a run is due while the previous run is still going
+func WithOverlap(policy OverlapPolicy) JobOption {
+	return func(j *Job) {
+		j.Overlap = policy
+	}
+}
+
+// WithCatchUp sets how runs missed while the scheduler was stopped are handled when it starts
+// Only runs within lookback of the start time are considered, a lookback of zero uses DefaultCatchUpLookback
+func WithCatchUp(policy CatchUpPolicy, lookback time.Duration) JobOption {
+	return func(j *Job) {
+		j.CatchUp = policy
+		j.CatchUpLookback = lookback
+	}
+}
+
+// WithJitter delays each run by a random duration below max after its scheduled minute
+// The delay is fixed for each job and scheduled minute, so a run is never repeated with a different delay
+// With a cron string marking the start of each period, max works as a window the job runs once within
+func WithJitter(max time.Duration) JobOption {
+	return func(j *Job) {
+		j.Jitter = max
+	}
+}
+
+// WithLocation evaluates the job's cron string in the given time zone instead of the clock's
+// Runs follow the zone's daylight saving time changes without being repeated or lost
+func WithLocation(loc *time.Location) JobOption {
+	return func(j *Job) {
+		j.Location = loc
+	}
+}
+
+// DefaultCatchUpLookback is how far back missed runs are looked for when a job doesn't set its own lookback
+const DefaultCatchUpLookback = 24 * time.Hour
+
+// CatchUpPolicy decides what happens to runs missed while the scheduler was stopped
+type CatchUpPolicy int
+
+const (
+	// CatchUpSkip ignores missed runs. This is the default
+	CatchUpSkip CatchUpPolicy = iota
+	// CatchUpOnce runs the job once for the most recent missed run
+	CatchUpOnce
+	// CatchUpAll runs the job for every missed run, oldest first
+	CatchUpAll
+)
+
+// OverlapPolicy decides what happens when a job is due while its previous run is still going
+type OverlapPolicy int
+
+const (
+	// OverlapSkip drops the new run. This is the default
+	OverlapSkip OverlapPolicy = iota
+	// OverlapQueue starts the new run once the previous one finishes. At most one run is queued
+	OverlapQueue
+	// OverlapCancel cancels the previous run and starts the new one once it returns
+	OverlapCancel
+)
+
+// JobMetrics counts a job's runs and how late they started relative to their scheduled minute
+type JobMetrics struct {
+	Runs       int           // Runs started, not counting retries
+	Skipped    int           // Runs dropped because the previous run was still going
+	Suppressed int           // Runs skipped or deferred by a blackout
+	LastDelay  time.Duration // Start delay of the most recent run
+	MaxDelay   time.Duration // Largest start delay seen
+	TotalDelay time.Duration // Sum of all start delays
+}
+
+// AverageDelay returns the mean start delay over all runs
+func (m JobMetrics) AverageDelay() time.Duration {
+	if m.Runs == 0 {
+		return 0
+	}
+	return m.TotalDelay / time.Duration(m.Runs)
+}
+
+// record adds a run that started delay after its scheduled minute
+func (m *JobMetrics) record(delay time.Duration) {
+	m.Runs++
+	m.LastDelay = delay
+	m.TotalDelay += delay
+	if delay > m.MaxDelay {
+		m.MaxDelay = delay
+	}
+}
+
+// abandonGrace is how long a run may take to return after its context is done before it is abandoned
+const abandonGrace = 1 * time.Second
+
+// ErrTimeout is wrapped by the error of a run that exceeded its job's timeout
+var ErrTimeout = errors.New("job timed out")
+
+// ErrCancelled is wrapped by the error of a run that was stopped with Cancel
+var ErrCancelled = errors.New("job was cancelled")
+
 // Job to be run and all of its metadata
+// Jobs are shared with the scheduler's run loop, use SetActive to toggle a job while the scheduler runs
 type Job struct {
-	ID          string             // Job's uid
-	Cron        string             // cron string. Supports special characters *,- only
-	Description string             // Short description of job
-	Active      bool               // inactive jobs are not run
-	running     bool               // If job is currently running
-	Rerun       bool               // Determines if jobs are rerun on next cycle following an error
-	cancel      context.CancelFunc // For cancellation and timeouts
-	ctx         context.Context    // Context for JobFunc
-	mu          *sync.Mutex        // Only one call to Run() can hold the lock
-	err         error              // error from last run, otherwise nil
-	Job         JobFunc            // Actual job to be run
+	ID              string             // Job's uid
+	Cron            string             // cron string. Supports lists, ranges, steps, names and @ macros. Change it with Reschedule
+	schedule        *Schedule          // Parsed form of Cron
+	clock           Clock              // Clock of the scheduler that owns the job
+	Description     string             // Short description of job
+	Active          bool               // inactive jobs are not run
+	running         bool               // If job is currently running
+	Retry           RetryPolicy        // How failed runs are retried
+	attempt         int                // Attempt number of the current or last run, starting at 1
+	retryScheduled  time.Time          // Scheduled minute of the run waiting to be retried, zero if none
+	retryAt         time.Time          // When the waiting retry is due
+	retryGen        int                // Incremented for every planned retry so stale ones are ignored
+	Timeout         time.Duration      // Maximum duration of each run, zero for no limit
+	Jitter          time.Duration      // Largest random delay before each run, zero runs on the minute
+	Stagger         time.Duration      // Spread of the starts of each run's FanOut tasks
+	Location        *time.Location     // Time zone the cron string is evaluated in, the clock's time zone if nil
+	AllReplicas     bool               // Runs whether or not the scheduler is the leader
+	oneShot         *OneShot           // Set for jobs that run once instead of on a cron schedule
+	delayed         time.Time          // Scheduled minute of the run waiting out its jitter or a blackout, zero if none
+	delayedAt       time.Time          // When the delayed run is due
+	Blackout        Blackout           // Consulted before each run, may be nil
+	BlackoutPolicy  BlackoutPolicy     // What to do with runs due during a blackout
+	suppressed      suppression        // Last run stopped by a blackout, cleared when a run starts
+	Overlap         OverlapPolicy      // What to do when a run is due while the previous one is going
+	pending         time.Time          // Scheduled time of a run queued behind the current one, zero if none
+	metrics         JobMetrics         // Run counts and start delays
+	tasks           Summary            // Task outcomes of the last run made with FanOut that had tasks
+	CatchUp         CatchUpPolicy      // What to do with runs missed while the scheduler was stopped
+	CatchUpLookback time.Duration      // How far back to look for missed runs
+	lastRun         time.Time          // Scheduled minute of the last successful run
+	evaluated       time.Time          // Latest scheduled minute the scheduler decided whether to run, so none runs twice
+	store           Store              // Store of the scheduler that owns the job, may be nil
+	listeners       []Listener         // Listeners of the scheduler that owns the job
+	health          *heartbeat         // Heartbeat of the scheduler that owns the job, counts recovered panics
+	skips           []Event            // Skipped runs to tell listeners about once j.mu is released
+	cancel          context.CancelFunc // Cancels the in-flight run, nil when not running
+	cancelled       bool               // If Cancel was called during the in-flight run
+	mu              sync.Mutex         // Guards every unexported field after creation, and Active
+	err             error              // error from last run, otherwise nil
+	Job             JobFunc            // Actual job to be run
 }
 
 // Status returns user-friendly string with job's current status
-func (j Job) Status() string {
+func (j *Job) Status() string {
+	j.mu.Lock()
+	active, err, metrics := j.Active, j.err, j.metrics
+	attempt, retryAt, suppressed, tasks := j.attempt, j.retryAt, j.suppressed, j.tasks
+	j.mu.Unlock()
+
+	now := j.clock.Now()
+	status := j.errorStatus(active, err)
+	if !suppressed.scheduled.IsZero() && suppressed.until.IsZero() {
+		status = fmt.Sprintf("%s\nRun for %s was skipped by a blackout: %s", status, formatRunTime(suppressed.scheduled, now), suppressed.reason)
+	} else if !suppressed.scheduled.IsZero() {
+		status = fmt.Sprintf("%s\nRun for %s was deferred until %s by a blackout: %s", status, formatRunTime(suppressed.scheduled, now), formatRunTime(suppressed.until, now), suppressed.reason)
+	}
+	if !retryAt.IsZero() {
+		status = fmt.Sprintf("%s\nAttempt %v of %v failed, retrying %s", status, attempt, j.Retry.MaxAttempts, formatRunTime(retryAt, now))
+	} else if attempt > 1 {
+		status = fmt.Sprintf("%s\nLast run took %v attempts", status, attempt)
+	}
+	if tasks.Total() > 0 {
+		status = fmt.Sprintf("%s\nLast run's tasks: %v", status, tasks)
+	}
+	if metrics.Runs > 0 {
+		status = fmt.Sprintf("%s\nLast run started %v late, worst %v, %v runs skipped", status, metrics.LastDelay.Round(time.Millisecond), metrics.MaxDelay.Round(time.Millisecond), metrics.Skipped)
+	}
+	if metrics.Suppressed > 0 {
+		status = fmt.Sprintf("%s\n%v runs suppressed by blackouts", status, metrics.Suppressed)
+	}
+	return status
+}
+
+// errorStatus describes the job's state and the outcome of its last run
+func (j *Job) errorStatus(active bool, err error) string {
 	activeStatus := "inactive"
-	if j.Active {
+	if active {
 		activeStatus = "active"
 	}
-	if j.err == nil {
-		return fmt.Sprintf("Job %v is %s with no error", j.ID, activeStatus)
+	nextRun := formatRunTime(j.NextRun(), j.clock.Now())
+	switch {
+	case err == nil:
+		return fmt.Sprintf("Job %v is %s with no error, next run %s", j.ID, activeStatus, nextRun)
+	case errors.Is(err, ErrTimeout):
+		return fmt.Sprintf("Job %v is %s and its last run timed out, next run %s:\n%v", j.ID, activeStatus, nextRun, err)
+	case errors.Is(err, ErrCancelled):
+		return fmt.Sprintf("Job %v is %s and its last run was cancelled, next run %s", j.ID, activeStatus, nextRun)
 	}
-	return fmt.Sprintf("Job %v is %s with error:\n%v", j.ID, activeStatus, j.err)
+	return fmt.Sprintf("Job %v is %s with error, next run %s:\n%v", j.ID, activeStatus, nextRun, err)
+}
+
+// Metrics returns a copy of the job's run counts and start delays
+func (j *Job) Metrics() JobMetrics {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.metrics
 }
 
-// Cancel will stop the job's current execution and reset the context
-// BUG: Context is not properly reset. It will stay cancelled
-func (j *Job) Cancel() {
+// LastRun returns the scheduled minute of the job's last successful run, or the zero time if it has not succeeded
+func (j *Job) LastRun() time.Time {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.lastRun
+}
+
+// NextRun returns the next time the job is scheduled to run after now, including its jitter
+func (j *Job) NextRun() time.Time {
+	j.mu.Lock()
+	delayed, delayedAt, schedule := j.delayed, j.delayedAt, j.schedule
+	j.mu.Unlock()
+	if !delayed.IsZero() {
+		return delayedAt
+	}
+	if schedule == nil {
+		return time.Time{}
+	}
+	next := schedule.Next(j.local(j.clock.Now()))
+	if next.IsZero() {
+		return next
+	}
+	return next.Add(j.jitter(next))
+}
+
+// local returns t in the job's time zone
+func (j *Job) local(t time.Time) time.Time {
+	if j.Location == nil {
+		return t
+	}
+	return t.In(j.Location)
+}
+
+// Schedule returns the job's parsed cron schedule, nil for one-shot jobs
+func (j *Job) Schedule() *Schedule {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.schedule
+}
+
+// SetActive enables or disables the job. Inactive jobs are skipped by the scheduler
+func (j *Job) SetActive(active bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.Active = active
+}
+
+// Cancel aborts the job's in-flight run. Later and queued runs are not affected
+// Returns false if the job was not running
+func (j *Job) Cancel() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !j.running || j.cancel == nil {
+		return false
+	}
+	j.cancelled = true
 	j.cancel()
-	ctx, cancel := context.WithCancel(context.Background())
-	j.ctx = ctx
-	j.cancel = cancel
+	return true
 }
 
-// Run the job. Returns early if job is inactive or does not need to be run
-// Updates error if job returns with error
-func (j *Job) run() {
-	// Ensure the task is active and not running
+// claim decides if the job runs for the scheduled minute and, if so, marks it as running
+// Returns the scheduled time the run is for. A job that is still running is handled by its Overlap policy
+func (j *Job) claim(scheduled time.Time) (time.Time, bool) {
+	defer j.flushSkips()
 	j.mu.Lock()
-	if !j.Active || j.running {
-		j.mu.Unlock()
-		return
+	defer j.mu.Unlock()
+	if !j.Active {
+		return time.Time{}, false
+	}
+
+	return j.claimDue(scheduled, j.schedule != nil && j.schedule.Matches(j.local(scheduled)))
+}
+
+// evaluate records that the scheduler is deciding whether the job runs for the scheduled minute
+// Returns false if it already did, such as after the clock went back, so no minute runs twice
+func (j *Job) evaluate(scheduled time.Time) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !scheduled.After(j.evaluated) {
+		return false
+	}
+	j.evaluated = scheduled
+	return true
+}
+
+// claimDelayed marks the job as running for a run that has waited out its jitter, unless it was superseded
+func (j *Job) claimDelayed(scheduled time.Time) (time.Time, bool) {
+	defer j.flushSkips()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !j.delayed.Equal(scheduled) || !j.Active {
+		return time.Time{}, false
+	}
+	j.delayed, j.delayedAt = time.Time{}, time.Time{}
+	return j.claimDue(scheduled, true)
+}
+
+// claimDue marks the job as running if it is due or has a queued run. Must hold j.mu
+func (j *Job) claimDue(scheduled time.Time, due bool) (time.Time, bool) {
+	if j.running {
+		if due {
+			j.overlap(scheduled)
+		}
+		return time.Time{}, false
+	}
+
+	// Runs queued while an abandoned run was finishing are picked up on the next tick
+	if !due && j.pending.IsZero() {
+		return time.Time{}, false
+	}
+	if !due {
+		scheduled = j.pending
+	}
+	j.pending = time.Time{}
+	j.start()
+	return scheduled, true
+}
+
+// claimRetry marks the job as running for a planned retry, unless a newer run has made it stale
+// Returns the scheduled minute of the run being retried
+func (j *Job) claimRetry(gen int) (time.Time, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if gen != j.retryGen || j.retryScheduled.IsZero() || j.running || !j.Active {
+		return time.Time{}, false
 	}
+	scheduled := j.retryScheduled
+	j.retryScheduled, j.retryAt = time.Time{}, time.Time{}
+	j.attempt++
 	j.running = true
-	j.mu.Unlock()
+	return scheduled, true
+}
 
-	// Parse CRON tab, return early for invalid cron formats
-	runnable, err := canRun(j.Cron)
-	if err != nil {
-		j.err = err
-		return
+// delay plans a jittered run for the scheduled minute instead of running it straight away
+// Returns how long to wait before claiming it with claimDelayed. Jobs without jitter, or that are not due, aren't delayed
+func (j *Job) delay(scheduled time.Time) (time.Duration, bool) {
+	if j.Jitter <= 0 || j.oneShot != nil {
+		return 0, false
+	}
+	defer j.flushSkips()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !j.Active || !j.schedule.Matches(j.local(scheduled)) {
+		return 0, false
 	}
+	// A run still waiting when the next one is due is dropped
+	if !j.delayed.IsZero() {
+		j.metrics.Skipped++
+		j.skip(j.delayed, "a newer run was due before it")
+	}
+	j.delayed, j.delayedAt = scheduled, scheduled.Add(j.jitter(scheduled))
+	return j.waitFor(scheduled), true
+}
 
-	// Run if runnable or error occurred on last run
-	if runnable || (j.err != nil && j.Rerun) {
-		j.err = j.Job(j.ctx)
+// delayPending plans the jittered run of the current period if it hasn't succeeded and is not yet due
+// Lets a restarted scheduler keep a run whose random time is still ahead
+func (j *Job) delayPending(now time.Time) (time.Time, time.Duration, bool) {
+	if j.Jitter <= 0 || j.oneShot != nil {
+		return time.Time{}, 0, false
 	}
-	j.running = false
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	scheduled := j.schedule.Prev(j.local(now.Truncate(time.Minute).Add(time.Minute)))
+	if scheduled.IsZero() || !scheduled.After(j.lastRun) || !j.Active {
+		return time.Time{}, 0, false
+	}
+	if !scheduled.Add(j.jitter(scheduled)).After(now) {
+		return time.Time{}, 0, false
+	}
+	j.delayed, j.delayedAt = scheduled, scheduled.Add(j.jitter(scheduled))
+	return scheduled, j.waitFor(scheduled), true
+}
+
+// oneShotPending returns the time of a one-shot job's run if it has yet to run
+func (j *Job) oneShotPending() (time.Time, bool) {
+	if j.oneShot == nil {
+		return time.Time{}, false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.delayed.IsZero() || j.running {
+		return time.Time{}, false
+	}
+	return j.delayed, true
+}
+
+// isRunning reports if the job is running
+func (j *Job) isRunning() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.running
+}
+
+// waitFor returns how long from now until the jittered run for the scheduled minute is due
+func (j *Job) waitFor(scheduled time.Time) time.Duration {
+	wait := scheduled.Add(j.jitter(scheduled)).Sub(j.clock.Now())
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// jitter returns the random delay of the run for the scheduled minute
+// It is derived from the job ID and the minute so it is the same every time it is asked for, even after a restart
+func (j *Job) jitter(scheduled time.Time) time.Duration {
+	if j.Jitter <= 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s %d", j.ID, scheduled.Unix())
+	return time.Duration(rand.New(rand.NewSource(int64(h.Sum64()))).Int63n(int64(j.Jitter)))
 }
 
-// Parses crontab format and determines if it is time to run jobFunc
-// Will return true if wait time has been exceeded
-func canRun(cron string) (runnable bool, err error) {
-	// Get cron values for current time
-	now := time.Now()
-	hour, min, _ := now.Clock()
-	_, month, day := now.Date()
-	weekday := now.Weekday()
+// start marks the job as running the first attempt of a new scheduled run, superseding any waiting retry. Must hold j.mu
+func (j *Job) start() {
+	j.running = true
+	j.attempt = 1
+	j.retryScheduled, j.retryAt = time.Time{}, time.Time{}
+}
 
-	current := []int{min, hour, day, int(month), int(weekday)}
+// blackout consults the job's Blackout before running for the scheduled minute
+// Returns true if the run must not happen now, along with the deferred run to plan if the policy defers it
+func (j *Job) blackout(scheduled time.Time) (*retry, bool) {
+	if j.Blackout == nil {
+		return nil, false
+	}
+	now := j.clock.Now()
+	until, reason, err := j.Blackout.BlackedOut(j.local(now))
+	if err != nil {
+		log.Printf("Error checking blackout of job %v: %v", j.ID, err)
+		return nil, false
+	}
+	if !until.After(now) {
+		return nil, false
+	}
 
-	// Split cron string into fields
-	fields := strings.Split(cron, " ")
+	defer j.flushSkips()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.running = false
+	j.metrics.Suppressed++
+	if j.BlackoutPolicy != BlackoutDefer {
+		j.suppressed = suppression{scheduled: scheduled, reason: reason}
+		j.skip(scheduled, fmt.Sprintf("blacked out: %s", reason))
+		return nil, true
+	}
+	if !j.delayed.IsZero() && !j.delayed.Equal(scheduled) {
+		j.metrics.Skipped++
+		j.skip(j.delayed, "a newer run was due before it")
+	}
+	j.skip(scheduled, fmt.Sprintf("deferred until %s by a blackout: %s", until.Format("Mon Jan 2 15:04"), reason))
+	j.suppressed = suppression{scheduled: scheduled, reason: reason, until: until}
+	j.delayed, j.delayedAt = scheduled, until
+	return &retry{delay: until.Sub(now), deferred: scheduled}, true
+}
 
-	// Ensure correct number of fields in cron string
-	if len(fields) != 5 {
-		return false, fmt.Errorf("Invalid length of cron string")
+// planRetry decides if the run for the scheduled minute is retried after failing. Must hold j.mu
+func (j *Job) planRetry(scheduled time.Time) *retry {
+	if j.err == nil || errors.Is(j.err, ErrCancelled) || j.attempt >= j.Retry.MaxAttempts {
+		return nil
 	}
+	delay := j.Retry.backoff(j.attempt)
+	j.retryGen++
+	j.retryScheduled = scheduled
+	j.retryAt = j.clock.Now().Add(delay)
+	return &retry{delay: delay, gen: j.retryGen}
+}
 
-	for i, field := range fields {
-		runnable, ok := cronFieldCheck(field, current[i])
-		if !ok {
-			return false, fmt.Errorf("Invalid cron format. This application accepts only integers and characters '*' ',' and '-'")
+// overlap applies the job's Overlap policy to a run that is due while the job is running. Must hold j.mu
+func (j *Job) overlap(scheduled time.Time) {
+	switch j.Overlap {
+	case OverlapQueue:
+		if !j.pending.IsZero() {
+			j.metrics.Skipped++
+			j.skip(j.pending, "replaced by a newer queued run")
+		}
+		j.pending = scheduled
+	case OverlapCancel:
+		if !j.pending.IsZero() {
+			j.metrics.Skipped++
+			j.skip(j.pending, "replaced by a newer queued run")
 		}
-		if !runnable {
-			return false, nil
+		j.pending = scheduled
+		if j.cancel != nil {
+			j.cancelled = true
+			j.cancel()
 		}
+	default:
+		j.metrics.Skipped++
+		j.skip(scheduled, "the previous run was still going")
 	}
-	return true, nil
 }
 
-// Check if cron field is runnable
-func cronFieldCheck(input string, compare int) (runnable bool, ok bool) {
-	// return true if input is "*"
-	if input == "*" {
-		return true, true
+// skip records a run that was dropped or deferred so listeners are told once j.mu is released. Must hold j.mu
+func (j *Job) skip(scheduled time.Time, reason string) {
+	if len(j.listeners) == 0 {
+		return
 	}
+	j.skips = append(j.skips, Event{Run: Run{JobID: j.ID, Scheduled: scheduled}, At: j.clock.Now(), Reason: reason})
+}
 
-	// Validate if cron field is a list of values
-	if strings.Contains(input, ",") {
-		for _, val := range strings.Split(input, ",") {
-			intVal, err := strconv.Atoi(val)
-			if err != nil {
-				return false, false
-			}
-			if intVal == compare {
-				return true, true
-			}
+// flushSkips tells listeners about the runs recorded with skip. Must not hold j.mu
+func (j *Job) flushSkips() {
+	j.mu.Lock()
+	skips := j.skips
+	j.skips = nil
+	j.mu.Unlock()
+	for _, e := range skips {
+		for _, l := range j.listeners {
+			l.OnSkipped(e)
+		}
+	}
+}
+
+// notifyScheduled tells listeners that a claimed run for the scheduled minute is about to be run
+func (j *Job) notifyScheduled(scheduled time.Time) {
+	if len(j.listeners) == 0 {
+		return
+	}
+	j.mu.Lock()
+	e := Event{Run: Run{JobID: j.ID, Scheduled: scheduled}, At: j.clock.Now(), Attempt: j.attempt}
+	j.mu.Unlock()
+	for _, l := range j.listeners {
+		l.OnScheduled(e)
+	}
+}
+
+// notifyFinished tells listeners how a run ended
+func (j *Job) notifyFinished(e Event) {
+	for _, l := range j.listeners {
+		if e.Err == nil {
+			l.OnSuccess(e)
+		} else {
+			l.OnError(e)
 		}
-		return false, true
 	}
+}
 
-	// Validate if cron field is a range of values
-	if strings.Contains(input, "-") {
-		fieldRange := strings.Split(input, "-")
-		if len(fieldRange) != 2 {
-			return false, false
+// execute runs a claimed job, followed by any run queued while it was going
+// Updates error if job returns with error. Returns the retry to make if the last run failed,
+// or the deferred run if a blackout stopped it, otherwise nil
+func (j *Job) execute(scheduled time.Time) *retry {
+	for {
+		if r, blocked := j.blackout(scheduled); blocked {
+			return r
 		}
-		start, err := strconv.Atoi(fieldRange[0])
-		if err != nil {
-			return false, false
+		e, abandoned := j.runOnce(scheduled)
+
+		j.mu.Lock()
+		r := j.planRetry(scheduled)
+		e.RetryAt = j.retryAt
+		if abandoned || j.pending.IsZero() || !j.Active {
+			if !abandoned {
+				j.running = false
+			}
+			j.mu.Unlock()
+			j.notifyFinished(e)
+			return r
 		}
-		end, err := strconv.Atoi(fieldRange[1])
-		if err != nil {
-			return false, false
+		scheduled = j.pending
+		j.pending = time.Time{}
+		j.start()
+		j.mu.Unlock()
+		j.notifyFinished(e)
+		j.notifyScheduled(scheduled)
+	}
+}
+
+// runOnce calls the JobFunc for the scheduled minute and records the outcome
+// Returns the event describing how the run ended, and true if the JobFunc ignored its context and was abandoned
+func (j *Job) runOnce(scheduled time.Time) (e Event, abandoned bool) {
+	// Every run gets a fresh context so an earlier cancellation or timeout doesn't carry over
+	base, count, stats := newRunContext(scheduled, j)
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if j.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(base, j.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(base)
+	}
+
+	start := j.clock.Now()
+	j.mu.Lock()
+	j.cancel = cancel
+	j.cancelled = false
+	j.suppressed = suppression{}
+	attempt := j.attempt
+	// Retries start late on purpose, so only first attempts count towards the start delay
+	if attempt <= 1 {
+		j.metrics.record(start.Sub(scheduled.Add(j.jitter(scheduled))))
+	}
+	j.mu.Unlock()
+
+	for _, l := range j.listeners {
+		l.OnStart(Event{Run: Run{JobID: j.ID, Scheduled: scheduled, Start: start}, At: start, Attempt: attempt})
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		// A panicking JobFunc fails its run instead of crashing the process
+		defer func() {
+			if r := recover(); r != nil {
+				j.health.panicked(r)
+				done <- recovered(fmt.Sprintf("job %v", j.ID), r)
+			}
+		}()
+		done <- j.Job(ctx)
+	}()
+
+	// Stop waiting shortly after the context is done so a JobFunc that ignores it can't stall a worker
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		select {
+		case err = <-done:
+		case <-j.clock.After(abandonGrace):
+			err, abandoned = ctx.Err(), true
 		}
-		if start > end {
-			return false, false
+	}
+
+	j.mu.Lock()
+	j.err = j.runError(ctx, err)
+	j.cancel = nil
+	run := Run{
+		JobID:     j.ID,
+		Scheduled: scheduled,
+		Start:     start,
+		End:       j.clock.Now(),
+		Outcome:   outcomeOf(j.err),
+		Err:       j.err,
+		Count:     int(atomic.LoadInt64(count)),
+		Tasks:     stats.summary(),
+	}
+	if run.Tasks.Total() > 0 {
+		j.tasks = run.Tasks
+	}
+	succeeded := j.err == nil && !abandoned && scheduled.After(j.lastRun)
+	if succeeded {
+		j.lastRun = scheduled
+	}
+	j.mu.Unlock()
+	cancel()
+
+	if succeeded && j.store != nil {
+		if err := j.store.SaveLastRun(j.ID, scheduled); err != nil {
+			log.Printf("Error saving last run of job %v: %v", j.ID, err)
 		}
-		if compare >= start && compare <= end {
-			return true, true
+	}
+
+	// An abandoned JobFunc still counts as running until it returns, so it never overlaps itself
+	if abandoned {
+		go func() {
+			<-done
+			j.mu.Lock()
+			j.running = false
+			j.mu.Unlock()
+		}()
+	}
+	return Event{Run: run, At: run.End, Attempt: attempt}, abandoned
+}
+
+// missedRuns lists the scheduled minutes up to now that were missed since the job's last successful run
+// The list follows the job's CatchUp policy and is limited to its lookback
+func (j *Job) missedRuns(now time.Time) []time.Time {
+	j.mu.Lock()
+	last, policy, lookback, schedule := j.lastRun, j.CatchUp, j.CatchUpLookback, j.schedule
+	j.mu.Unlock()
+
+	// Jobs that have never succeeded, and one-shot jobs, have nothing to catch up on
+	if policy == CatchUpSkip || last.IsZero() || schedule == nil {
+		return nil
+	}
+	if lookback <= 0 {
+		lookback = DefaultCatchUpLookback
+	}
+	from := last
+	if limit := now.Add(-lookback); from.Before(limit) {
+		from = limit
+	}
+
+	// Runs whose jitter hasn't passed yet are not missed
+	missed := make([]time.Time, 0)
+	for t := schedule.Next(j.local(from)); !t.IsZero() && !t.After(now); t = schedule.Next(t) {
+		if t.Add(j.jitter(t)).After(now) {
+			continue
 		}
-		return false, true
+		missed = append(missed, t)
 	}
-	inputVal, err := strconv.Atoi(input)
-	if err != nil {
-		return false, false
+	if policy == CatchUpOnce && len(missed) > 1 {
+		missed = missed[len(missed)-1:]
+	}
+	return missed
+}
+
+// runError wraps the error of a run that was cancelled or timed out. Must hold j.mu
+func (j *Job) runError(ctx context.Context, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case j.cancelled:
+		return fmt.Errorf("%w: %v", ErrCancelled, err)
+	case ctx.Err() == context.DeadlineExceeded:
+		return fmt.Errorf("%w after %v: %v", ErrTimeout, j.Timeout, err)
+	}
+	return err
+}
+
+// formatRunTime describes t relative to now, such as "today at 15:04" or "at Mon Jan 2 15:04"
+func formatRunTime(t, now time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	y, m, d := t.Date()
+	if ny, nm, nd := now.Date(); y == ny && m == nm && d == nd {
+		return fmt.Sprintf("today at %s", t.Format("15:04"))
 	}
-	if inputVal == compare {
-		return true, true
+	if ty, tm, td := now.AddDate(0, 0, 1).Date(); y == ty && m == tm && d == td {
+		return fmt.Sprintf("tomorrow at %s", t.Format("15:04"))
 	}
-	return false, true
+	return fmt.Sprintf("at %s", t.Format("Mon Jan 2 15:04"))
 }
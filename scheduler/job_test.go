@@ -1,53 +1,79 @@
 package scheduler
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 )
 
-func TestCronFieldCheck(t *testing.T) {
+func TestParseCronField(t *testing.T) {
 	tests := []struct {
 		inputInput   string
 		inputCompare int
+		inputBounds  cronBounds
 		wantRunnable bool
 		wantOk       bool
 	}{
-		{"*", 5, true, true},
-		{"5", 5, true, true},
-		{"4,5,6", 5, true, true},
-		{"0-10", 5, true, true},
-		{"0-10", 5, true, true},
+		{"*", 5, minuteBounds, true, true},
+		{"5", 5, minuteBounds, true, true},
+		{"4,5,6", 5, minuteBounds, true, true},
+		{"0-10", 5, minuteBounds, true, true},
+		{"0-10", 5, minuteBounds, true, true},
+		{"*/15", 45, minuteBounds, true, true},
+		{"5/15", 50, minuteBounds, true, true},
+		{"9-21/4", 17, hourBounds, true, true},
+		{"1-5,10,20-25", 22, domBounds, true, true},
+		{"1-5,10,20-25", 10, domBounds, true, true},
+		{"JAN", 1, monthBounds, true, true},
+		{"jun-aug", 7, monthBounds, true, true},
+		{"MON-FRI", 3, weekdayBounds, true, true},
+		{"7", 0, weekdayBounds, true, true},
+		{"?", 4, weekdayBounds, true, true},
 	}
 	for _, test := range tests {
-		if gotRunnable, gotOk := cronFieldCheck(test.inputInput, test.inputCompare); gotRunnable != test.wantRunnable || gotOk != test.wantOk {
-			t.Errorf("intCast(%q, %v) = %v, %v", test.inputInput, test.inputCompare, gotRunnable, gotOk)
+		values, err := parseCronField(test.inputInput, test.inputBounds)
+		if gotRunnable, gotOk := has(values, test.inputCompare), err == nil; gotRunnable != test.wantRunnable || gotOk != test.wantOk {
+			t.Errorf("parseCronField(%q) has %v = %v, %v", test.inputInput, test.inputCompare, gotRunnable, gotOk)
 		}
 	}
 }
 
-func TestCronFieldCheckFailure(t *testing.T) {
+func TestParseCronFieldFailure(t *testing.T) {
 	tests := []struct {
 		inputInput   string
 		inputCompare int
+		inputBounds  cronBounds
 		wantRunnable bool
 		wantOk       bool
 	}{
-		{"abc", 5, false, false},
-		{"4,,6", 5, false, false},
-		{"7,8,9", 5, false, true},
-		{"5-4", 5, false, false},
-		{"0-4", 5, false, true},
-		{"4", 5, false, true},
+		{"abc", 5, minuteBounds, false, false},
+		{"4,,6", 5, minuteBounds, false, false},
+		{"7,8,9", 5, minuteBounds, false, true},
+		{"5-4", 5, minuteBounds, false, false},
+		{"0-4", 5, minuteBounds, false, true},
+		{"4", 5, minuteBounds, false, true},
+		{"*/15", 20, minuteBounds, false, true},
+		{"*/0", 0, minuteBounds, false, false},
+		{"*/x", 0, minuteBounds, false, false},
+		{"60", 0, minuteBounds, false, false},
+		{"0", 0, domBounds, false, false},
+		{"1-2-3", 1, hourBounds, false, false},
+		{"jan", 1, weekdayBounds, false, false},
+		{"sat-mon", 0, weekdayBounds, false, false},
+		{"MON-FRI", 6, weekdayBounds, false, true},
 	}
 	for _, test := range tests {
-		if gotRunnable, gotOk := cronFieldCheck(test.inputInput, test.inputCompare); gotRunnable != test.wantRunnable || gotOk != test.wantOk {
-			t.Errorf("intCast(%q, %v) = %v, %v", test.inputInput, test.inputCompare, gotRunnable, gotOk)
+		values, err := parseCronField(test.inputInput, test.inputBounds)
+		if gotRunnable, gotOk := has(values, test.inputCompare), err == nil; gotRunnable != test.wantRunnable || gotOk != test.wantOk {
+			t.Errorf("parseCronField(%q) has %v = %v, %v", test.inputInput, test.inputCompare, gotRunnable, gotOk)
 		}
 	}
 }
 
-func TestCanRun(t *testing.T) {
+func TestScheduleMatches(t *testing.T) {
 	now := time.Now()
 	hour, min, _ := now.Clock()
 	_, month, day := now.Date()
@@ -56,15 +82,125 @@ func TestCanRun(t *testing.T) {
 	tests := []struct {
 		input        string
 		wantRunnable bool
-		wantErr      error
 	}{
-		{"* * * * *", true, nil},
-		{fmt.Sprintf("%v %v %v %v %v", min, hour, day, int(month), int(weekday)), true, nil},
+		{"* * * * *", true},
+		{"@hourly", min == 0},
+		{"*/1 * * * *", true},
+		{"  *   *  * * *  ", true},
+		{fmt.Sprintf("%v %v %v %v %v", min, hour, day, int(month), int(weekday)), true},
+		{fmt.Sprintf("%v %v %v * %v", min, hour, day, (int(weekday)+1)%7), true},
+		{fmt.Sprintf("%v %v %v * *", min, hour, day%28+1), false},
 	}
 
 	for _, test := range tests {
-		if gotRunnable, gotErr := canRun(test.input); gotRunnable != test.wantRunnable || gotErr != test.wantErr {
-			t.Errorf("canRun(%q) = %v, %v", test.input, gotRunnable, gotErr)
+		schedule, err := ParseSchedule(test.input)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q) returned error %v", test.input, err)
+			continue
 		}
+		if gotRunnable := schedule.Matches(now); gotRunnable != test.wantRunnable {
+			t.Errorf("Matches(%q) = %v", test.input, gotRunnable)
+		}
+	}
+}
+
+func TestParseScheduleFailure(t *testing.T) {
+	tests := []string{
+		"* * * *",
+		"* * * * * *",
+		"@fortnightly",
+		"* * * foo *",
+		"*/15 25 * * *",
+	}
+
+	for _, test := range tests {
+		if _, gotErr := ParseSchedule(test); gotErr == nil {
+			t.Errorf("ParseSchedule(%q) returned no error", test)
+		}
+	}
+}
+
+func TestJobTimeout(t *testing.T) {
+	s := New(newFakeClock(time.Date(2021, time.January, 4, 0, 0, 0, 0, time.UTC)))
+	s.AddJob("1", "* * * * *", "", true, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, WithTimeout(10*time.Millisecond))
+	job, _ := s.FindJob("1")
+
+	runNow(s)
+	if !errors.Is(job.err, ErrTimeout) {
+		t.Errorf("job error = %v, want ErrTimeout", job.err)
+	}
+	if !strings.Contains(job.Status(), "timed out") {
+		t.Errorf("Status() = %q, want timed out", job.Status())
+	}
+}
+
+func TestJobTimeoutAbandonsIgnoredContext(t *testing.T) {
+	clock := newFakeClock(time.Date(2021, time.January, 4, 0, 0, 0, 0, time.UTC))
+	s := New(clock)
+	release := make(chan struct{})
+	s.AddJob("1", "* * * * *", "", true, func(ctx context.Context) error {
+		<-release
+		return nil
+	}, WithTimeout(10*time.Millisecond))
+	job, _ := s.FindJob("1")
+
+	// run must return even though the JobFunc ignores its context, once the scheduler's clock says the grace is over
+	start := time.Now()
+	go clock.Advance(abandonGrace)
+	runNow(s)
+	if elapsed := time.Since(start); elapsed >= abandonGrace {
+		t.Errorf("abandoning the run took %v of real time, want it timed by the scheduler's clock", elapsed)
+	}
+	if !errors.Is(job.err, ErrTimeout) {
+		t.Errorf("job error = %v, want ErrTimeout", job.err)
+	}
+	job.mu.Lock()
+	running := job.running
+	job.mu.Unlock()
+	if !running {
+		t.Errorf("abandoned job is not marked running")
+	}
+	close(release)
+}
+
+func TestJobCancel(t *testing.T) {
+	clock := newFakeClock(time.Date(2021, time.January, 4, 0, 0, 0, 0, time.UTC))
+	s := New(clock)
+	started := make(chan struct{}, 1)
+	s.AddJob("1", "* * * * *", "", true, func(ctx context.Context) error {
+		started <- struct{}{}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+			return nil
+		}
+	})
+	job, _ := s.FindJob("1")
+
+	if job.Cancel() {
+		t.Errorf("Cancel() = true for a job that is not running")
+	}
+
+	go func() {
+		<-started
+		job.Cancel()
+	}()
+	runNow(s)
+	if !errors.Is(job.err, ErrCancelled) {
+		t.Errorf("job error = %v, want ErrCancelled", job.err)
+	}
+	if !strings.Contains(job.Status(), "cancelled") {
+		t.Errorf("Status() = %q, want cancelled", job.Status())
+	}
+
+	// The next run gets a fresh context
+	clock.Jump(time.Minute)
+	runNow(s)
+	if job.err != nil {
+		t.Errorf("run after cancel returned error %v", job.err)
 	}
 }
@@ -0,0 +1,26 @@
+package scheduler
+
+// Leader elects one scheduler to run jobs when several replicas share the same jobs
+// Implementations must be safe for concurrent use
+type Leader interface {
+	// Lead tries to become or stay the leader, returning true if this replica leads
+	Lead() (bool, error)
+	// Resign gives up leadership so another replica can take over straight away
+	Resign() error
+}
+
+// WithLeader runs jobs only while this scheduler is the leader, checked every minute
+// A scheduler that becomes leader catches up on runs missed since the last leader's successful runs,
+// so a Store should be given as well. Jobs added with WithAllReplicas run whether or not the scheduler leads
+func WithLeader(leader Leader) Option {
+	return func(s *Scheduler) {
+		s.leader = leader
+	}
+}
+
+// WithAllReplicas runs the job on every replica rather than only the leader, for jobs that maintain each replica's own state
+func WithAllReplicas() JobOption {
+	return func(j *Job) {
+		j.AllReplicas = true
+	}
+}
@@ -0,0 +1,54 @@
+package scheduler
+
+import "time"
+
+// Listener observes runs of every job, for logging, metrics, alerting or history
+// Callbacks are called synchronously by the scheduler so they should return promptly
+// Implementations must be safe for concurrent use
+type Listener interface {
+	// OnScheduled is called when a run is due and handed to the worker pool
+	OnScheduled(e Event)
+	// OnStart is called just before the JobFunc is called
+	OnStart(e Event)
+	// OnSuccess is called when a run returns without error
+	OnSuccess(e Event)
+	// OnError is called when a run returns an error, times out or is cancelled
+	OnError(e Event)
+	// OnSkipped is called when a due run is dropped, or deferred by a blackout, instead of run
+	OnSkipped(e Event)
+}
+
+// Event describes something that happened to a run of a job
+// Fields of the embedded Run that aren't known yet, such as End before the run finishes, are zero
+type Event struct {
+	Run
+	At      time.Time // When the event happened
+	Attempt int       // Attempt number of the run, starting at 1, zero for runs that were skipped
+	RetryAt time.Time // When a failed run will be retried, zero if it won't be
+	Reason  string    // Why the run was skipped, for OnSkipped
+}
+
+// WithListener tells l about every run of every job. It may be given more than once
+func WithListener(l Listener) Option {
+	return func(s *Scheduler) {
+		s.listeners = append(s.listeners, l)
+	}
+}
+
+// NopListener ignores every event. Embed it to implement only some of Listener's callbacks
+type NopListener struct{}
+
+// OnScheduled does nothing
+func (NopListener) OnScheduled(Event) {}
+
+// OnStart does nothing
+func (NopListener) OnStart(Event) {}
+
+// OnSuccess does nothing
+func (NopListener) OnSuccess(Event) {}
+
+// OnError does nothing
+func (NopListener) OnError(Event) {}
+
+// OnSkipped does nothing
+func (NopListener) OnSkipped(Event) {}
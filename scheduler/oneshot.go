@@ -0,0 +1,202 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// OneShot is a job that runs once at a set time and then removes itself
+// Its JobFunc is built from its Kind and Payload by a handler, so it can be persisted and restored after a restart
+type OneShot struct {
+	ID      string    // Job's uid
+	At      time.Time // When the job runs
+	Kind    string    // Selects the handler registered with HandleOneShot
+	Payload string    // Passed to the handler, such as who to text
+}
+
+// OneShotHandler builds the JobFunc of a one-shot job from its payload
+// Returns an error if the payload is invalid
+type OneShotHandler func(payload string) (JobFunc, error)
+
+// OneShotStore persists one-shot jobs until they have run
+// Implementations must be safe for concurrent use
+type OneShotStore interface {
+	// SaveOneShot records a one-shot job that has yet to run
+	SaveOneShot(o OneShot) error
+	// DeleteOneShot forgets a one-shot job once it has run or been removed
+	DeleteOneShot(id string) error
+	// OneShots returns every one-shot job that has yet to run
+	OneShots() ([]OneShot, error)
+}
+
+// WithOneShotStore persists one-shot jobs so they survive restarts
+// One-shot jobs due while the scheduler was stopped run as soon as it starts
+func WithOneShotStore(store OneShotStore) Option {
+	return func(s *Scheduler) {
+		s.oneShots = store
+	}
+}
+
+// oneShotKind is a registered kind of one-shot job
+type oneShotKind struct {
+	handler OneShotHandler // Builds the job's JobFunc
+	opts    []JobOption    // Applied to every job of the kind
+}
+
+// HandleOneShot registers the handler for one-shot jobs of a kind
+// Options such as WithRetry apply to every job of the kind. Handlers must be registered before Start
+func (s *Scheduler) HandleOneShot(kind string, handler OneShotHandler, opts ...JobOption) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.kinds[kind] = oneShotKind{handler: handler, opts: opts}
+}
+
+// AddOneShot adds a job that runs once at the given time and then removes itself
+// A time in the past runs the job straight away. The job is saved to the OneShotStore, if there is one,
+// before its run is planned so it can't run and be deleted before it is saved
+// Returns an error if the id is taken, the kind has no handler, or the payload is invalid
+func (s *Scheduler) AddOneShot(id string, at time.Time, kind, payload string) error {
+	o := OneShot{ID: id, At: at, Kind: kind, Payload: payload}
+	job, err := s.newOneShot(o)
+	if err != nil {
+		return err
+	}
+
+	s.oneShotMu.Lock()
+	defer s.oneShotMu.Unlock()
+	if s.oneShots != nil {
+		if _, ok := s.FindJob(id); ok {
+			return fmt.Errorf("Job store already contains job with key %v", id)
+		}
+		if err := s.oneShots.SaveOneShot(o); err != nil {
+			return fmt.Errorf("Error saving one-shot job %v: %v", id, err)
+		}
+	}
+	if err := s.addOneShot(job); err != nil {
+		if s.oneShots != nil {
+			if err := s.oneShots.DeleteOneShot(id); err != nil {
+				log.Printf("Error deleting one-shot job %v: %v", id, err)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// AddDelayed adds a job that runs once after the delay and then removes itself
+func (s *Scheduler) AddDelayed(id string, delay time.Duration, kind, payload string) error {
+	return s.AddOneShot(id, s.clock.Now().Add(delay), kind, payload)
+}
+
+// newOneShot builds a one-shot job from its kind's handler
+func (s *Scheduler) newOneShot(o OneShot) (*Job, error) {
+	s.mu.RLock()
+	kind, ok := s.kinds[o.Kind]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("No handler for one-shot job kind %q", o.Kind)
+	}
+	jobFunc, err := kind.handler(o.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %v job: %v", o.Kind, err)
+	}
+
+	job := &Job{
+		ID:          o.ID,
+		clock:       s.clock,
+		listeners:   s.listeners,
+		health:      s.beat,
+		Description: fmt.Sprintf("Runs %v once", o.Kind),
+		Active:      true,
+		Job:         jobFunc,
+		oneShot:     &o,
+		delayed:     o.At,
+		delayedAt:   o.At,
+	}
+	for _, opt := range kind.opts {
+		opt(job)
+	}
+	return job, nil
+}
+
+// addOneShot adds a one-shot job to the job store and plans its run
+func (s *Scheduler) addOneShot(job *Job) error {
+	s.mu.Lock()
+	if _, ok := s.jobs[job.ID]; ok {
+		s.mu.Unlock()
+		return fmt.Errorf("Job store already contains job with key %v", job.ID)
+	}
+	s.jobs[job.ID] = job
+	s.mu.Unlock()
+
+	s.runLater(job, job.oneShot.At, job.waitFor(job.oneShot.At))
+	return nil
+}
+
+// syncOneShots adds one-shot jobs saved by another replica or before a restart,
+// and drops those another replica has already run
+func (s *Scheduler) syncOneShots() {
+	if s.oneShots == nil {
+		return
+	}
+	s.oneShotMu.Lock()
+	defer s.oneShotMu.Unlock()
+	saved, err := s.oneShots.OneShots()
+	if err != nil {
+		log.Printf("Error loading one-shot jobs: %v", err)
+		return
+	}
+
+	pending := make(map[string]bool)
+	for _, o := range saved {
+		pending[o.ID] = true
+		if _, ok := s.FindJob(o.ID); ok {
+			continue
+		}
+		job, err := s.newOneShot(o)
+		if err == nil {
+			err = s.addOneShot(job)
+		}
+		if err != nil {
+			log.Printf("Error restoring one-shot job %v: %v", o.ID, err)
+		}
+	}
+	for _, job := range s.snapshot() {
+		if job.oneShot != nil && !pending[job.ID] && !job.isRunning() {
+			s.removeJob(job.ID)
+		}
+	}
+}
+
+// finishOneShot removes a one-shot job once it has run, unless it is waiting to be retried or deferred
+func (s *Scheduler) finishOneShot(job *Job) {
+	if job.oneShot == nil {
+		return
+	}
+	if s.oneShots != nil {
+		if err := s.oneShots.DeleteOneShot(job.ID); err != nil {
+			log.Printf("Error deleting one-shot job %v: %v", job.ID, err)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.jobs[job.ID] == job {
+		delete(s.jobs, job.ID)
+	}
+}
+
+// HandleOneShot registers the handler for one-shot jobs of a kind in the default scheduler
+func HandleOneShot(kind string, handler OneShotHandler, opts ...JobOption) {
+	defaultScheduler.HandleOneShot(kind, handler, opts...)
+}
+
+// AddOneShot adds a job that runs once at the given time to the default scheduler
+func AddOneShot(id string, at time.Time, kind, payload string) error {
+	return defaultScheduler.AddOneShot(id, at, kind, payload)
+}
+
+// AddDelayed adds a job that runs once after the delay to the default scheduler
+func AddDelayed(id string, delay time.Duration, kind, payload string) error {
+	return defaultScheduler.AddDelayed(id, delay, kind, payload)
+}
@@ -0,0 +1,232 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memOneShotStore is a OneShotStore kept in memory
+type memOneShotStore struct {
+	mu       sync.Mutex
+	oneShots map[string]OneShot
+}
+
+func newMemOneShotStore() *memOneShotStore {
+	return &memOneShotStore{oneShots: make(map[string]OneShot)}
+}
+
+func (m *memOneShotStore) SaveOneShot(o OneShot) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.oneShots[o.ID] = o
+	return nil
+}
+
+func (m *memOneShotStore) DeleteOneShot(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.oneShots, id)
+	return nil
+}
+
+func (m *memOneShotStore) OneShots() ([]OneShot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	oneShots := make([]OneShot, 0, len(m.oneShots))
+	for _, o := range m.oneShots {
+		oneShots = append(oneShots, o)
+	}
+	return oneShots, nil
+}
+
+// textHandler records the payload and scheduled time of every run of a one-shot job
+type textHandler struct {
+	mu    sync.Mutex
+	texts []string
+	times []time.Time
+}
+
+func (h *textHandler) handle(payload string) (JobFunc, error) {
+	if payload == "" {
+		return nil, errors.New("nothing to send")
+	}
+	return func(ctx context.Context) error {
+		scheduled, _ := ScheduledTime(ctx)
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.texts = append(h.texts, payload)
+		h.times = append(h.times, scheduled)
+		return nil
+	}, nil
+}
+
+func TestOneShotRunsOnce(t *testing.T) {
+	now := time.Date(2021, time.January, 4, 10, 0, 0, 0, time.UTC)
+	clock := newFakeClock(now)
+	store := newMemOneShotStore()
+	s := New(clock, WithOneShotStore(store))
+	handler := &textHandler{}
+	s.HandleOneShot("text", handler.handle)
+
+	if err := s.AddDelayed("1", 90*time.Minute, "text", "hello florence"); err != nil {
+		t.Fatalf("AddDelayed returned error %v", err)
+	}
+	job, _ := s.FindJob("1")
+	want := now.Add(90 * time.Minute)
+	if next := job.NextRun(); !next.Equal(want) {
+		t.Errorf("NextRun() = %v, want %v", next, want)
+	}
+
+	clock.settle = s.wg.Wait
+	go s.Start()
+	clock.Advance(3 * time.Hour)
+	s.Stop()
+
+	if len(handler.texts) != 1 || handler.texts[0] != "hello florence" || !handler.times[0].Equal(want) {
+		t.Errorf("one-shot ran with %v at %v, want once at %v", handler.texts, handler.times, want)
+	}
+	if _, ok := s.FindJob("1"); ok {
+		t.Errorf("one-shot job is still in the store after running")
+	}
+	if saved, _ := store.OneShots(); len(saved) != 0 {
+		t.Errorf("one-shot job is still saved after running: %v", saved)
+	}
+}
+
+func TestOneShotSurvivesRestart(t *testing.T) {
+	now := time.Date(2021, time.January, 4, 10, 0, 0, 0, time.UTC)
+	store := newMemOneShotStore()
+	handler := &textHandler{}
+
+	s := New(newFakeClock(now), WithOneShotStore(store))
+	s.HandleOneShot("text", handler.handle)
+	s.AddOneShot("due", now.Add(time.Hour), "text", "missed while down")
+	s.AddOneShot("later", now.Add(3*time.Hour), "text", "still ahead")
+	s.AddOneShot("removed", now.Add(time.Hour), "text", "never sent")
+	s.RemoveJob("removed")
+
+	// The server was down from 10:00 until noon
+	clock := newFakeClock(now.Add(2 * time.Hour))
+	s = New(clock, WithOneShotStore(store))
+	s.HandleOneShot("text", handler.handle)
+	clock.settle = s.wg.Wait
+	go s.Start()
+	clock.Advance(time.Minute)
+	if len(handler.texts) != 1 || handler.texts[0] != "missed while down" {
+		t.Errorf("after restart one-shots ran with %v, want the missed one", handler.texts)
+	}
+	clock.Advance(time.Hour)
+	s.Stop()
+
+	if len(handler.texts) != 2 || handler.texts[1] != "still ahead" {
+		t.Errorf("one-shots ran with %v, want both pending ones once", handler.texts)
+	}
+}
+
+func TestRemoveUnloadedOneShot(t *testing.T) {
+	now := time.Date(2021, time.January, 4, 10, 0, 0, 0, time.UTC)
+	store := newMemOneShotStore()
+	store.SaveOneShot(OneShot{ID: "resume", At: now.Add(time.Hour), Kind: "text", Payload: "welcome back"})
+
+	// Saved by another replica, this scheduler never loaded it
+	s := New(newFakeClock(now), WithOneShotStore(store))
+	s.RemoveJob("resume")
+	if saved, _ := store.OneShots(); len(saved) != 0 {
+		t.Errorf("one-shot job is still saved after RemoveJob: %v", saved)
+	}
+}
+
+// orderedOneShotStore is a OneShotStore that reports its calls in order, with saves as slow as a remote database's
+type orderedOneShotStore struct {
+	*memOneShotStore
+	calls   chan string
+	saveErr error // Returned by SaveOneShot, if set
+}
+
+func (o *orderedOneShotStore) SaveOneShot(one OneShot) error {
+	time.Sleep(20 * time.Millisecond)
+	if o.saveErr != nil {
+		return o.saveErr
+	}
+	err := o.memOneShotStore.SaveOneShot(one)
+	o.calls <- "save " + one.ID
+	return err
+}
+
+func (o *orderedOneShotStore) DeleteOneShot(id string) error {
+	err := o.memOneShotStore.DeleteOneShot(id)
+	o.calls <- "delete " + id
+	return err
+}
+
+func TestOneShotSavedBeforeRun(t *testing.T) {
+	store := &orderedOneShotStore{memOneShotStore: newMemOneShotStore(), calls: make(chan string, 10)}
+	s := New(RealClock(), WithOneShotStore(store))
+	s.HandleOneShot("text", func(payload string) (JobFunc, error) {
+		return func(context.Context) error {
+			store.calls <- "run " + payload
+			return nil
+		}, nil
+	})
+
+	// A job due in the past runs straight away, but not before it is saved
+	if err := s.AddOneShot("1", time.Now().Add(-time.Minute), "text", "hello florence"); err != nil {
+		t.Fatalf("AddOneShot returned error %v", err)
+	}
+	for _, want := range []string{"save 1", "run hello florence", "delete 1"} {
+		select {
+		case call := <-store.calls:
+			if call != want {
+				t.Fatalf("store got %q, want %q", call, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("store is still waiting for %q", want)
+		}
+	}
+	if saved, _ := store.OneShots(); len(saved) != 0 {
+		t.Errorf("one-shot job is still saved after running: %v", saved)
+	}
+
+	// A job that can't be saved is never added
+	store.saveErr = errors.New("connection refused")
+	if err := s.AddOneShot("2", time.Now().Add(-time.Minute), "text", "hello florence"); err == nil {
+		t.Errorf("AddOneShot returned no error when the save failed")
+	}
+	if _, ok := s.FindJob("2"); ok {
+		t.Errorf("one-shot job that wasn't saved was added")
+	}
+	select {
+	case call := <-store.calls:
+		t.Errorf("store got %q for a job that wasn't saved", call)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestAddOneShotFailure(t *testing.T) {
+	s := New(RealClock())
+	handler := &textHandler{}
+	s.HandleOneShot("text", handler.handle)
+	s.AddJob("taken", "* * * * *", "", true, nil)
+
+	tests := []struct {
+		id, kind, payload string
+	}{
+		{"1", "unknown", "hello"},
+		{"1", "text", ""},
+		{"taken", "text", "hello"},
+	}
+	for _, test := range tests {
+		if err := s.AddOneShot(test.id, time.Now().Add(time.Hour), test.kind, test.payload); err == nil {
+			t.Errorf("AddOneShot(%q, %q, %q) returned no error", test.id, test.kind, test.payload)
+		}
+	}
+
+	s.AddOneShot("once", time.Now().Add(time.Hour), "text", "hello")
+	if err := s.Reschedule("once", "0 * * * *"); err == nil {
+		t.Errorf("Reschedule of one-shot job returned no error")
+	}
+	s.RemoveJob("once")
+}
@@ -0,0 +1,51 @@
+package scheduler
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy decides how a failed run is retried
+// Retries happen after their delay, independent of the job's cron minute. Cancelled runs are never retried
+type RetryPolicy struct {
+	MaxAttempts  int           // Total attempts including the first, values below 2 disable retries
+	InitialDelay time.Duration // Delay before the first retry
+	Multiplier   float64       // Factor the delay grows by after each retry, values below 1 are treated as 1
+	MaxDelay     time.Duration // Largest delay between attempts, zero for no limit
+	Jitter       float64       // Fraction of the delay randomly added or removed, from 0 to 1
+}
+
+// WithRetry retries failed runs of the job according to policy
+func WithRetry(policy RetryPolicy) JobOption {
+	return func(j *Job) {
+		j.Retry = policy
+	}
+}
+
+// retry is a planned retry of a failed run, or a run deferred by a blackout
+type retry struct {
+	delay    time.Duration // How long to wait before retrying
+	gen      int           // Retry generation, a newer run of the job makes older generations stale
+	deferred time.Time     // Scheduled minute of a deferred run, zero for a retry
+}
+
+// backoff returns the delay before retrying after the given attempt, starting at 1
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	delay := float64(p.InitialDelay) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+
+	// Spread retries out so failures at the same minute don't all retry at once
+	if p.Jitter > 0 {
+		jitter := math.Min(p.Jitter, 1)
+		seed := rand.NewSource(time.Now().UnixNano())
+		delay += delay * jitter * (2*rand.New(seed).Float64() - 1)
+	}
+	return time.Duration(delay)
+}
@@ -0,0 +1,130 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		policy  RetryPolicy
+		attempt int
+		want    time.Duration
+	}{
+		{RetryPolicy{InitialDelay: 10 * time.Second, Multiplier: 2}, 1, 10 * time.Second},
+		{RetryPolicy{InitialDelay: 10 * time.Second, Multiplier: 2}, 3, 40 * time.Second},
+		{RetryPolicy{InitialDelay: 10 * time.Second, Multiplier: 2, MaxDelay: 30 * time.Second}, 3, 30 * time.Second},
+		{RetryPolicy{InitialDelay: 10 * time.Second}, 4, 10 * time.Second},
+		{RetryPolicy{InitialDelay: 10 * time.Second, Multiplier: 0.5}, 2, 10 * time.Second},
+	}
+
+	for _, test := range tests {
+		if got := test.policy.backoff(test.attempt); got != test.want {
+			t.Errorf("%+v.backoff(%v) = %v, want %v", test.policy, test.attempt, got, test.want)
+		}
+	}
+}
+
+func TestRetryBackoffJitter(t *testing.T) {
+	policy := RetryPolicy{InitialDelay: 10 * time.Second, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		if got := policy.backoff(1); got < 5*time.Second || got > 15*time.Second {
+			t.Fatalf("backoff with jitter = %v, want between 5s and 15s", got)
+		}
+	}
+}
+
+func TestRetryUntilSuccess(t *testing.T) {
+	clock := newFakeClock(time.Date(2021, time.January, 4, 10, 9, 30, 0, time.UTC))
+	s := New(clock)
+
+	var mu sync.Mutex
+	attempts := make([]time.Time, 0)
+	s.AddJob("1", "10 10 * * *", "", true, func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts = append(attempts, clock.Now())
+		if len(attempts) < 3 {
+			return errors.New("twilio is down")
+		}
+		return nil
+	}, WithRetry(RetryPolicy{MaxAttempts: 5, InitialDelay: 10 * time.Second, Multiplier: 2}))
+	job, _ := s.FindJob("1")
+
+	clock.settle = s.wg.Wait
+	go s.Start()
+	clock.Advance(3 * time.Minute)
+	s.Stop()
+
+	// Ticks land on the minute even though the scheduler started mid-minute
+	first := time.Date(2021, time.January, 4, 10, 10, 0, 0, time.UTC)
+	want := []time.Time{first, first.Add(10 * time.Second), first.Add(30 * time.Second)}
+	if len(attempts) != len(want) {
+		t.Fatalf("job ran at %v, want %v", attempts, want)
+	}
+	for i := range want {
+		if !attempts[i].Equal(want[i]) {
+			t.Errorf("attempt %v ran at %v, want %v", i+1, attempts[i], want[i])
+		}
+	}
+	if !strings.Contains(job.Status(), "3 attempts") {
+		t.Errorf("Status() = %q, missing attempt count", job.Status())
+	}
+	// Retries don't count as late starts
+	if m := job.Metrics(); m.Runs != 1 || m.MaxDelay != 0 {
+		t.Errorf("metrics = %+v, want one run on time", m)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	clock := newFakeClock(time.Date(2021, time.January, 4, 10, 10, 0, 0, time.UTC))
+	s := New(clock)
+	runs := 0
+	s.AddJob("1", "10 10 * * *", "", true, func(ctx context.Context) error {
+		runs++
+		return errors.New("twilio is down")
+	}, WithRetry(RetryPolicy{MaxAttempts: 2, InitialDelay: time.Second}))
+	job, _ := s.FindJob("1")
+
+	runNow(s)
+	if !strings.Contains(job.Status(), "Attempt 1 of 2 failed") {
+		t.Errorf("Status() = %q, missing pending retry", job.Status())
+	}
+	clock.settle = s.wg.Wait
+	go s.Start()
+	clock.Advance(time.Minute)
+	s.Stop()
+
+	if runs != 2 {
+		t.Errorf("job ran %v times, want 2", runs)
+	}
+	if !job.retryAt.IsZero() {
+		t.Errorf("a retry is still planned after the last attempt")
+	}
+}
+
+func TestCancelledRunIsNotRetried(t *testing.T) {
+	clock := newFakeClock(time.Date(2021, time.January, 4, 10, 10, 0, 0, time.UTC))
+	s := New(clock)
+	started := make(chan struct{}, 1)
+	s.AddJob("1", "10 10 * * *", "", true, func(ctx context.Context) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	}, WithRetry(RetryPolicy{MaxAttempts: 3, InitialDelay: time.Second}))
+	job, _ := s.FindJob("1")
+
+	go func() {
+		<-started
+		job.Cancel()
+	}()
+	runNow(s)
+
+	if !job.retryAt.IsZero() {
+		t.Errorf("cancelled run was planned for retry")
+	}
+}
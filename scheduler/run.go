@@ -0,0 +1,111 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// Outcome describes how a run ended
+type Outcome string
+
+const (
+	OutcomeSuccess   Outcome = "success"   // JobFunc returned nil
+	OutcomeError     Outcome = "error"     // JobFunc returned an error
+	OutcomeTimeout   Outcome = "timed out" // Run exceeded the job's timeout
+	OutcomeCancelled Outcome = "cancelled" // Run was stopped with Cancel or by an overlapping run
+)
+
+// Run describes a single finished run of a job
+type Run struct {
+	JobID     string    // ID of the job that ran
+	Scheduled time.Time // Minute the run was scheduled for
+	Start     time.Time // When the JobFunc was called
+	End       time.Time // When the JobFunc returned or was abandoned
+	Outcome   Outcome   // How the run ended
+	Err       error     // Error of the run, nil on success
+	Count     int       // Items the run reported with AddCount, such as users messaged
+	Tasks     Summary   // Outcomes of the run's tasks if its JobFunc was made with FanOut
+}
+
+// Duration returns how long the run took
+func (r Run) Duration() time.Duration {
+	return r.End.Sub(r.Start)
+}
+
+// History records every run of every job
+// Implementations must be safe for concurrent use
+type History interface {
+	RecordRun(run Run) error
+}
+
+// WithHistory records every run of every job in h
+func WithHistory(h History) Option {
+	return WithListener(historyListener{history: h})
+}
+
+// historyListener records finished runs in a History
+type historyListener struct {
+	NopListener
+	history History
+}
+
+func (l historyListener) OnSuccess(e Event) {
+	l.record(e.Run)
+}
+
+func (l historyListener) OnError(e Event) {
+	l.record(e.Run)
+}
+
+func (l historyListener) record(run Run) {
+	if err := l.history.RecordRun(run); err != nil {
+		log.Printf("Error recording run of job %v: %v", run.JobID, err)
+	}
+}
+
+// outcomeOf classifies the error of a run
+func outcomeOf(err error) Outcome {
+	switch {
+	case err == nil:
+		return OutcomeSuccess
+	case errors.Is(err, ErrTimeout):
+		return OutcomeTimeout
+	case errors.Is(err, ErrCancelled):
+		return OutcomeCancelled
+	}
+	return OutcomeError
+}
+
+// scheduledTimeKey is the context key holding the minute a run was scheduled for
+type scheduledTimeKey struct{}
+
+// countKey is the context key holding the run's item counter
+type countKey struct{}
+
+// newRunContext returns a context carrying the minute a run was scheduled for, its item counter,
+// the outcomes of its FanOut tasks, and the job that is running
+func newRunContext(scheduled time.Time, job *Job) (context.Context, *int64, *taskStats) {
+	count := new(int64)
+	stats := &taskStats{}
+	ctx := context.WithValue(context.Background(), scheduledTimeKey{}, scheduled)
+	ctx = context.WithValue(ctx, countKey{}, count)
+	ctx = context.WithValue(ctx, taskStatsKey{}, stats)
+	return context.WithValue(ctx, jobKey{}, job), count, stats
+}
+
+// ScheduledTime returns the minute the current run was scheduled for, which may be earlier than the time it started
+func ScheduledTime(ctx context.Context) (time.Time, bool) {
+	scheduled, ok := ctx.Value(scheduledTimeKey{}).(time.Time)
+	return scheduled, ok
+}
+
+// AddCount adds n to the number of items, such as users messaged, the current run has processed
+// It is recorded in the run's history. Does nothing if ctx does not belong to a run
+func AddCount(ctx context.Context, n int) {
+	if count, ok := ctx.Value(countKey{}).(*int64); ok {
+		atomic.AddInt64(count, int64(n))
+	}
+}
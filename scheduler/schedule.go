@@ -0,0 +1,225 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+)
+
+// searchLimit bounds how far Next and Prev look before giving up on impossible schedules such as "0 0 30 2 *"
+const searchLimit = 5 * 366 * 24 * time.Hour
+
+// maxClockChange bounds how far clocks move when a time zone changes offset, such as for daylight saving time
+const maxClockChange = 3 * time.Hour
+
+// Schedule is a parsed cron expression that can be matched against times
+type Schedule struct {
+	expr          string // Original cron expression
+	minute        uint64 // Bitsets of matching values for each field
+	hour          uint64
+	dom           uint64
+	month         uint64
+	weekday       uint64
+	domRestricted bool // Day of month is not a wildcard
+	dowRestricted bool // Day of week is not a wildcard
+}
+
+// ParseSchedule parses a cron expression into a Schedule
+// Returns an error describing the first invalid field
+func ParseSchedule(cron string) (*Schedule, error) {
+	fields, err := splitCron(cron)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]uint64, len(fields))
+	for i, field := range fields {
+		v, err := parseCronField(field, fieldBounds[i])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid cron format for %s field %q: %v", fieldBounds[i].name, field, err)
+		}
+		values[i] = v
+	}
+
+	return &Schedule{
+		expr:          cron,
+		minute:        values[0],
+		hour:          values[1],
+		dom:           values[2],
+		month:         values[3],
+		weekday:       values[4],
+		domRestricted: isRestricted(fields[2]),
+		dowRestricted: isRestricted(fields[4]),
+	}, nil
+}
+
+// String returns the cron expression the schedule was parsed from
+func (s *Schedule) String() string {
+	return s.expr
+}
+
+// Matches reports if the schedule runs during the minute containing t, in t's location
+// When clocks go back only the first of the repeated minutes matches, and when clocks go forward
+// the skipped minutes match the first minute after the change, so no run is doubled or lost
+func (s *Schedule) Matches(t time.Time) bool {
+	t = t.Truncate(time.Minute)
+	if s.matchesWall(wall(t)) {
+		return !repeated(t)
+	}
+	for w := wall(t.Add(-time.Minute)).Add(time.Minute); w.Before(wall(t)); w = w.Add(time.Minute) {
+		if s.matchesWall(w) {
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns the first scheduled minute strictly after t, in t's location
+// Returns the zero time if the schedule never runs
+func (s *Schedule) Next(t time.Time) time.Time {
+	w := wall(t)
+	limit := w.Add(searchLimit)
+	for {
+		if w = s.nextWall(w, limit); w.IsZero() {
+			return time.Time{}
+		}
+		if next := firstInstant(w, t.Location()); next.After(t) {
+			return next
+		}
+	}
+}
+
+// Prev returns the last scheduled minute strictly before t, in t's location
+// Returns the zero time if the schedule never runs
+func (s *Schedule) Prev(t time.Time) time.Time {
+	w := wall(t)
+	if t.Truncate(time.Minute).Before(t) {
+		w = w.Add(time.Minute)
+	}
+	// After clocks go back, minutes later on the wall clock than t have already happened
+	_, offset := t.Zone()
+	if _, before := t.Add(-maxClockChange).Zone(); before > offset {
+		w = w.Add(time.Duration(before-offset) * time.Second)
+	}
+	limit := w.Add(-searchLimit)
+	for {
+		if w = s.prevWall(w, limit); w.IsZero() {
+			return time.Time{}
+		}
+		if prev := firstInstant(w, t.Location()); prev.Before(t) {
+			return prev
+		}
+	}
+}
+
+// nextWall returns the first matching wall clock minute strictly after w, which is in UTC so has no time zone transitions
+// Returns the zero time if there is none before limit
+func (s *Schedule) nextWall(w, limit time.Time) time.Time {
+	w = w.Add(time.Minute)
+	for w.Before(limit) {
+		if !has(s.month, int(w.Month())) {
+			w = time.Date(w.Year(), w.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !s.dayMatches(w) {
+			w = time.Date(w.Year(), w.Month(), w.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !has(s.hour, w.Hour()) {
+			w = time.Date(w.Year(), w.Month(), w.Day(), w.Hour()+1, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !has(s.minute, w.Minute()) {
+			w = w.Add(time.Minute)
+			continue
+		}
+		return w
+	}
+	return time.Time{}
+}
+
+// prevWall returns the last matching wall clock minute strictly before w, which is in UTC
+// Returns the zero time if there is none after limit
+func (s *Schedule) prevWall(w, limit time.Time) time.Time {
+	w = w.Add(-time.Minute)
+	for w.After(limit) {
+		if !has(s.month, int(w.Month())) {
+			w = time.Date(w.Year(), w.Month(), 1, 0, 0, 0, 0, time.UTC).Add(-time.Minute)
+			continue
+		}
+		if !s.dayMatches(w) {
+			w = time.Date(w.Year(), w.Month(), w.Day(), 0, 0, 0, 0, time.UTC).Add(-time.Minute)
+			continue
+		}
+		if !has(s.hour, w.Hour()) {
+			w = time.Date(w.Year(), w.Month(), w.Day(), w.Hour(), 0, 0, 0, time.UTC).Add(-time.Minute)
+			continue
+		}
+		if !has(s.minute, w.Minute()) {
+			w = w.Add(-time.Minute)
+			continue
+		}
+		return w
+	}
+	return time.Time{}
+}
+
+// matchesWall reports if the schedule matches the wall clock minute w
+func (s *Schedule) matchesWall(w time.Time) bool {
+	return has(s.minute, w.Minute()) && has(s.hour, w.Hour()) && has(s.month, int(w.Month())) && s.dayMatches(w)
+}
+
+// wall returns the wall clock minute of t as a time in UTC
+func wall(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+}
+
+// repeated reports if the wall clock minute of t already happened earlier, as it does when clocks go back
+func repeated(t time.Time) bool {
+	_, offset := t.Zone()
+	_, before := t.Add(-maxClockChange).Zone()
+	if before <= offset {
+		return false
+	}
+	return wall(t.Add(-time.Duration(before-offset) * time.Second)).Equal(wall(t))
+}
+
+// firstInstant returns the earliest minute in loc whose wall clock is w,
+// or the first minute after the change if clocks went forward past w
+func firstInstant(w time.Time, loc *time.Location) time.Time {
+	guess := time.Date(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute(), 0, 0, loc)
+	first := time.Time{}
+	for _, probe := range []time.Time{guess.Add(-maxClockChange), guess, guess.Add(maxClockChange)} {
+		_, offset := probe.Zone()
+		t := time.Unix(w.Unix()-int64(offset), 0).In(loc)
+		if wall(t).Equal(w) && (first.IsZero() || t.Before(first)) {
+			first = t
+		}
+	}
+	if !first.IsZero() {
+		return first
+	}
+
+	// w was skipped, so start from the offset after the change, which is before it happened, and find the change
+	_, offset := guess.Add(maxClockChange).Zone()
+	t := time.Unix(w.Unix()-int64(offset), 0).In(loc)
+	for !wall(t).After(w) {
+		t = t.Add(time.Minute)
+	}
+	return t
+}
+
+// dayMatches checks day of month and day of week
+// As in standard cron, if both are restricted then either matching is enough
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := has(s.dom, t.Day())
+	dowMatch := has(s.weekday, int(t.Weekday()))
+	if s.domRestricted && s.dowRestricted {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
+
+// has reports if bit n is set in the bitset
+func has(values uint64, n int) bool {
+	return values&(1<<uint(n)) != 0
+}
@@ -0,0 +1,161 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// Monday, January 4th 2021
+	base := time.Date(2021, time.January, 4, 10, 10, 30, 0, time.UTC)
+
+	tests := []struct {
+		cron string
+		from time.Time
+		want time.Time
+	}{
+		{"* * * * *", base, time.Date(2021, time.January, 4, 10, 11, 0, 0, time.UTC)},
+		{"10 10 * * *", base, time.Date(2021, time.January, 5, 10, 10, 0, 0, time.UTC)},
+		{"10 10 * * *", base.Add(-time.Minute), time.Date(2021, time.January, 4, 10, 10, 0, 0, time.UTC)},
+		{"*/15 9-21 * * *", base, time.Date(2021, time.January, 4, 10, 15, 0, 0, time.UTC)},
+		{"*/15 9-21 * * *", base.Add(12 * time.Hour), time.Date(2021, time.January, 5, 9, 0, 0, 0, time.UTC)},
+		{"0 10 * * MON-FRI", time.Date(2021, time.January, 8, 11, 0, 0, 0, time.UTC), time.Date(2021, time.January, 11, 10, 0, 0, 0, time.UTC)},
+		{"@monthly", base, time.Date(2021, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", base, time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * fri", base, time.Date(2021, time.January, 8, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", base, time.Time{}},
+	}
+
+	for _, test := range tests {
+		schedule, err := ParseSchedule(test.cron)
+		if err != nil {
+			t.Fatalf("ParseSchedule(%q) returned error %v", test.cron, err)
+		}
+		if got := schedule.Next(test.from); !got.Equal(test.want) {
+			t.Errorf("Next(%q, %v) = %v, want %v", test.cron, test.from, got, test.want)
+		}
+	}
+}
+
+func TestSchedulePrev(t *testing.T) {
+	// Monday, January 4th 2021
+	base := time.Date(2021, time.January, 4, 10, 10, 30, 0, time.UTC)
+
+	tests := []struct {
+		cron string
+		from time.Time
+		want time.Time
+	}{
+		{"* * * * *", base, time.Date(2021, time.January, 4, 10, 10, 0, 0, time.UTC)},
+		{"* * * * *", base.Truncate(time.Minute), time.Date(2021, time.January, 4, 10, 9, 0, 0, time.UTC)},
+		{"10 10 * * *", base, time.Date(2021, time.January, 4, 10, 10, 0, 0, time.UTC)},
+		{"10 10 * * *", base.Add(-time.Minute), time.Date(2021, time.January, 3, 10, 10, 0, 0, time.UTC)},
+		{"10 10 * * mon", base.Add(-time.Minute), time.Date(2020, time.December, 28, 10, 10, 0, 0, time.UTC)},
+		{"*/15 9-21 * * *", base, time.Date(2021, time.January, 4, 10, 0, 0, 0, time.UTC)},
+		{"@monthly", base, time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", base, time.Time{}},
+	}
+
+	for _, test := range tests {
+		schedule, err := ParseSchedule(test.cron)
+		if err != nil {
+			t.Fatalf("ParseSchedule(%q) returned error %v", test.cron, err)
+		}
+		if got := schedule.Prev(test.from); !got.Equal(test.want) {
+			t.Errorf("Prev(%q, %v) = %v, want %v", test.cron, test.from, got, test.want)
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	tests := []struct {
+		cron string
+		want string
+	}{
+		{"* * * * *", "every minute"},
+		{"*/15 9-21 * * *", "at minutes 0, 15, 30 and 45 past every hour from 9 AM through 9 PM"},
+		{"0 9-21 * * *", "at minute 0 past every hour from 9 AM through 9 PM"},
+		{"*/5 * * * *", "every 5 minutes"},
+		{"0-29 * * * *", "at minutes 0 through 29 past every hour"},
+		{"30 */2 * * *", "at minute 30 past every 2 hours"},
+		{"* 9,17 * * *", "every minute of the 9 AM and 5 PM hours"},
+		{"0 9 * * *", "at 9:00 AM"},
+		{"0 9,17 * * *", "at 9:00 AM and 5:00 PM"},
+		{"0 9 * * mon", "at 9:00 AM on Monday"},
+		{"0 10 * * MON-FRI", "at 10:00 AM on Monday through Friday"},
+		{"0 0 1,15 * *", "at 12:00 AM on days 1 and 15 of the month"},
+		{"0 0 1 * fri", "at 12:00 AM on day 1 of the month or on Friday"},
+		{"0 12 */2 * mon", "at 12:00 PM on every 2nd day of the month if it falls on Monday"},
+		{"0 0 * 6-8 sat,sun", "at 12:00 AM on Sunday and Saturday in June through August"},
+		{"@yearly", "at 12:00 AM on January 1"},
+		{"@hourly", "at minute 0 past every hour"},
+	}
+
+	for _, test := range tests {
+		got, err := Describe(test.cron)
+		if err != nil {
+			t.Fatalf("Describe(%q) returned error %v", test.cron, err)
+		}
+		if got != test.want {
+			t.Errorf("Describe(%q) = %q, want %q", test.cron, got, test.want)
+		}
+	}
+
+	if _, err := Describe("60 * * * *"); err == nil {
+		t.Errorf("Describe accepted an invalid cron expression")
+	}
+}
+
+func TestScheduleDaylightSaving(t *testing.T) {
+	toronto, err := time.LoadLocation("America/Toronto")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	// Clocks go forward from 2:00 to 3:00 on March 14th 2021, and back from 2:00 to 1:00 on November 7th 2021
+	forward := time.Date(2021, time.March, 14, 0, 0, 0, 0, toronto)
+	afterForward := time.Date(2021, time.March, 14, 3, 0, 0, 0, toronto)
+	back := time.Date(2021, time.November, 7, 0, 0, 0, 0, toronto)
+	firstOneThirty := time.Date(2021, time.November, 7, 5, 30, 0, 0, time.UTC).In(toronto)
+	secondOneThirty := firstOneThirty.Add(time.Hour)
+
+	tests := []struct {
+		cron string
+		from time.Time
+		next time.Time
+	}{
+		// Runs skipped by clocks going forward happen at 3:00, once
+		{"30 2 * * *", forward, afterForward},
+		{"30 2 * * *", afterForward, time.Date(2021, time.March, 15, 2, 30, 0, 0, toronto)},
+		{"*/20 2 * * *", forward, afterForward},
+		{"*/20 2 * * *", afterForward, time.Date(2021, time.March, 15, 2, 0, 0, 0, toronto)},
+		// Runs during the repeated hour happen the first time round only
+		{"30 1 * * *", back, firstOneThirty},
+		{"30 1 * * *", firstOneThirty, time.Date(2021, time.November, 8, 1, 30, 0, 0, toronto)},
+		{"*/30 * * * *", firstOneThirty, secondOneThirty.Add(30 * time.Minute)},
+	}
+
+	for _, test := range tests {
+		schedule, err := ParseSchedule(test.cron)
+		if err != nil {
+			t.Fatalf("ParseSchedule(%q) returned error %v", test.cron, err)
+		}
+		next := schedule.Next(test.from)
+		if !next.Equal(test.next) {
+			t.Errorf("Next(%q, %v) = %v, want %v", test.cron, test.from, next, test.next)
+		}
+		if !schedule.Matches(next) {
+			t.Errorf("Matches(%q, %v) = false, want true", test.cron, next)
+		}
+		if prev := schedule.Prev(next.Add(time.Minute)); !prev.Equal(next) {
+			t.Errorf("Prev(%q, %v) = %v, want %v", test.cron, next.Add(time.Minute), prev, next)
+		}
+	}
+
+	schedule, _ := ParseSchedule("30 1 * * *")
+	if schedule.Matches(secondOneThirty) {
+		t.Errorf("Matches(%v) = true for a repeated minute", secondOneThirty)
+	}
+	if prev := schedule.Prev(secondOneThirty.Add(time.Minute)); !prev.Equal(firstOneThirty) {
+		t.Errorf("Prev(%v) = %v, want %v", secondOneThirty.Add(time.Minute), prev, firstOneThirty)
+	}
+}
@@ -1,99 +1,511 @@
 package scheduler
 
 import (
-	"context"
 	"fmt"
+	"log"
 	"sync"
 	"time"
 )
 
-var jobs = make(map[string]Job)
-var stop = make(chan bool)
+// tickTolerance is how early a tick may fire and still count as the minute it was waiting for
+const tickTolerance = time.Second
 
-// Start begins running cron jobs
+// DefaultWorkers is the number of jobs a Scheduler runs at once unless WithWorkers is given
+const DefaultWorkers = 4
+
+// Scheduler runs jobs on their cron schedules
+type Scheduler struct {
+	clock      Clock                  // Source of time for schedules and ticks
+	mu         sync.RWMutex           // Guards jobs and leading
+	jobs       map[string]*Job        // Job store, keyed by job ID
+	stop       chan bool              // Signals Start to return
+	done       chan struct{}          // Closed by Stop so waiting retries are dropped
+	once       sync.Once              // Closes done once
+	workers    chan struct{}          // Semaphore bounding how many jobs run at once
+	store      Store                  // Persists job state, may be nil
+	listeners  []Listener             // Told about every run of every job
+	leader     Leader                 // Elects the replica that runs jobs, nil if this scheduler always runs them
+	leading    bool                   // If this scheduler was the leader at the last check
+	oneShots   OneShotStore           // Persists one-shot jobs, may be nil
+	oneShotMu  sync.Mutex             // Serializes saving one-shot jobs with restoring them, so none is added twice
+	kinds      map[string]oneShotKind // Handlers of one-shot jobs, keyed by kind
+	beat       *heartbeat             // Liveness of the scheduler loop
+	watchdog   func(Health)           // Told when the loop stalls or panics are recovered, may be nil
+	lastMinute time.Time              // Latest minute the loop evaluated, only used by the loop
+	wg         sync.WaitGroup         // Tracks runs that have been dispatched
+}
+
+// Option configures a Scheduler when it is created
+type Option func(*Scheduler)
+
+// WithWorkers sets how many jobs may run at once. Values below one are treated as one
+func WithWorkers(n int) Option {
+	return func(s *Scheduler) {
+		if n < 1 {
+			n = 1
+		}
+		s.workers = make(chan struct{}, n)
+	}
+}
+
+// New creates an empty Scheduler that uses the given clock
+func New(clock Clock, opts ...Option) *Scheduler {
+	s := &Scheduler{
+		clock:   clock,
+		jobs:    make(map[string]*Job),
+		kinds:   make(map[string]oneShotKind),
+		stop:    make(chan bool),
+		done:    make(chan struct{}),
+		workers: make(chan struct{}, DefaultWorkers),
+		beat:    &heartbeat{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// defaultScheduler backs the package-level functions
+var defaultScheduler = New(RealClock())
+
+// SetDefault replaces the scheduler used by the package-level functions
+// It should be called before any jobs are added or the scheduler is started
+func SetDefault(s *Scheduler) {
+	defaultScheduler = s
+}
+
+// Start begins running cron jobs, first catching up on runs missed while the scheduler was stopped
 // Recommended to run as a goroutine in main with a deferred Stop()
-func Start() {
-	timer := time.NewTicker(1 * time.Minute)
+func (s *Scheduler) Start() {
+	s.beat.start(s.clock.Now())
+	if s.watchdog != nil {
+		go s.watch()
+	}
+	s.lead()
+	if s.leads() {
+		s.syncOneShots()
+	}
+	s.catchUp(s.clock.Now())
 	for {
+		// Ticks are aligned to the start of each minute, so jobs run at :00 whenever the loop started
+		now := s.clock.Now()
+		select {
+		case <-s.stop:
+			return
+		case now := <-s.clock.After(now.Truncate(time.Minute).Add(time.Minute).Sub(now)):
+			s.tick(now)
+		}
+
+	}
+}
+
+// tick runs the scheduler loop for one minute, recording a heartbeat once it finishes
+// A panic is recovered so the loop carries on, but the tick doesn't count as finished
+func (s *Scheduler) tick(now time.Time) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.beat.panicked(r)
+			recovered("scheduler tick", r)
+		}
+	}()
+
+	// A new leader picks up where the last one stopped
+	elected := s.lead()
+	if s.leads() {
+		s.syncOneShots()
+	}
+	if elected {
+		s.catchUp(now)
+	}
+	if minute, ok := s.minuteDue(now); ok {
+		s.runJobs(minute)
+	}
+	s.beat.tick(s.clock.Now())
+}
+
+// minuteDue returns the minute a tick at now evaluates, false if it already was, such as after the clock went back
+// Runs due in minutes the loop skipped, such as after a system sleep, are caught up by each job's CatchUp policy
+func (s *Scheduler) minuteDue(now time.Time) (time.Time, bool) {
+	// A timer that fires a moment early belongs to the minute it was waiting for
+	minute := now.Add(tickTolerance).Truncate(time.Minute)
+	last := s.lastMinute
+	if !minute.After(last) {
+		log.Printf("Scheduler already evaluated %v, ignoring tick at %v", minute.Format("Mon Jan 2 15:04"), now.Format("15:04:05"))
+		s.beat.repeated()
+		return time.Time{}, false
+	}
+	s.lastMinute = minute
+	if skipped := int(minute.Sub(last)/time.Minute) - 1; !last.IsZero() && skipped > 0 {
+		log.Printf("Scheduler skipped %v minutes between %v and %v", skipped, last.Format("Mon Jan 2 15:04"), minute.Format("Mon Jan 2 15:04"))
+		s.beat.skipped(skipped)
+		s.catchUp(now)
+	}
+	return minute, true
+}
+
+// lead checks if the scheduler is the leader, returning true if it just became the leader
+// Without a Leader the scheduler always leads
+func (s *Scheduler) lead() bool {
+	leading := true
+	if s.leader != nil {
+		var err error
+		if leading, err = s.leader.Lead(); err != nil {
+			log.Printf("Error checking scheduler leadership: %v", err)
+			leading = false
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elected := leading && !s.leading
+	if s.leader != nil && leading != s.leading {
+		log.Printf("Scheduler leadership changed, leading: %v", leading)
+	}
+	s.leading = leading
+	return elected
+}
+
+// leads reports if the scheduler was the leader at the last check, or has no Leader
+func (s *Scheduler) leads() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.leading || s.leader == nil
+}
+
+// mayRun reports if the job may run on this replica
+func (s *Scheduler) mayRun(job *Job) bool {
+	return job.AllReplicas || s.leads()
+}
+
+// runJobs dispatches every job in the store that is due at the scheduled minute onto the worker pool
+// Jobs are run from a snapshot so the store can change while they run
+func (s *Scheduler) runJobs(scheduled time.Time) {
+	for _, job := range s.snapshot() {
+		if !s.mayRun(job) || !job.evaluate(scheduled) {
+			continue
+		}
+		if wait, ok := job.delay(scheduled); ok {
+			s.runLater(job, scheduled, wait)
+			continue
+		}
+		runAt, ok := job.claim(scheduled)
+		if !ok {
+			continue
+		}
+		s.execute(job, runAt)
+	}
+}
+
+// execute runs a claimed job on the worker pool and plans its retry if it fails
+func (s *Scheduler) execute(job *Job, scheduled time.Time) {
+	job.notifyScheduled(scheduled)
+	s.goWorker(func() {
+		if r := job.execute(scheduled); r != nil {
+			s.later(job, r)
+			return
+		}
+		s.finishOneShot(job)
+	})
+}
+
+// later plans a retry, or a run deferred by a blackout
+func (s *Scheduler) later(job *Job, r *retry) {
+	if !r.deferred.IsZero() {
+		s.runLater(job, r.deferred, r.delay)
+		return
+	}
+	s.retryLater(job, r)
+}
+
+// retryLater runs a failed job again once the retry's delay has passed, independent of the cron minute
+func (s *Scheduler) retryLater(job *Job, r *retry) {
+	s.clock.AfterFunc(r.delay, func() {
+		select {
+		case <-s.done:
+			return
+		default:
+		}
+		if !s.mayRun(job) {
+			return
+		}
+		if scheduled, ok := job.claimRetry(r.gen); ok {
+			s.execute(job, scheduled)
+		}
+	})
+}
+
+// runLater runs a jittered or deferred job once its delay has passed, independent of the cron minute
+func (s *Scheduler) runLater(job *Job, scheduled time.Time, wait time.Duration) {
+	s.clock.AfterFunc(wait, func() {
 		select {
-		case <-stop:
+		case <-s.done:
 			return
-		case <-timer.C:
-			for _, job := range jobs {
-				job.run()
+		default:
+		}
+		if !s.mayRun(job) {
+			return
+		}
+		if runAt, ok := job.claimDelayed(scheduled); ok {
+			s.execute(job, runAt)
+		}
+	})
+}
+
+// catchUp loads each job's last successful run from the store and runs what was missed up to now
+// Missed runs of a job are run in order on a single worker
+func (s *Scheduler) catchUp(now time.Time) {
+	for _, job := range s.snapshot() {
+		if !s.mayRun(job) {
+			continue
+		}
+		// Another leader may have run the job since it last ran here
+		if s.store != nil {
+			lastRun, err := s.store.LastRun(job.ID)
+			if err != nil {
+				log.Printf("Error loading last run of job %v: %v", job.ID, err)
+				continue
 			}
+			job.mu.Lock()
+			if lastRun.After(job.lastRun) {
+				job.lastRun = lastRun
+			}
+			job.mu.Unlock()
 		}
 
+		// A jittered run of the current period that is not yet due waits for its time as usual
+		if scheduled, wait, ok := job.delayPending(now); ok {
+			job.evaluate(scheduled)
+			s.runLater(job, scheduled, wait)
+		}
+		// One-shot jobs that came due while another replica led
+		if scheduled, ok := job.oneShotPending(); ok {
+			s.runLater(job, scheduled, job.waitFor(scheduled))
+		}
+
+		missed := job.missedRuns(now)
+		if len(missed) == 0 {
+			continue
+		}
+		// The tick doesn't run the minutes caught up here again
+		job.evaluate(missed[len(missed)-1])
+		job := job
+		s.goWorker(func() {
+			var r *retry
+			for _, scheduled := range missed {
+				if runAt, ok := job.claim(scheduled); ok {
+					job.notifyScheduled(runAt)
+					r = job.execute(runAt)
+				}
+			}
+			if r != nil {
+				s.later(job, r)
+			}
+		})
 	}
 }
 
-// Stop will halt the job runner
-func Stop() {
-	stop <- true
+// goWorker runs f on the worker pool, waiting for a free worker if they are all busy
+func (s *Scheduler) goWorker(f func()) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.workers <- struct{}{}
+		defer func() { <-s.workers }()
+		f()
+	}()
+}
+
+// snapshot returns the jobs currently in the store
+func (s *Scheduler) snapshot() []*Job {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	return jobs
+}
+
+// Stop will halt the job runner, drop waiting retries, and wait for dispatched runs to return
+// A leading scheduler resigns so another replica takes over
+func (s *Scheduler) Stop() {
+	s.stop <- true
+	s.beat.stop()
+	s.once.Do(func() { close(s.done) })
+	s.wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.leader != nil && s.leading {
+		if err := s.leader.Resign(); err != nil {
+			log.Printf("Error resigning scheduler leadership: %v", err)
+		}
+		s.leading = false
+	}
 }
 
 // Clear will empty the job store
-func Clear() {
-	jobs = make(map[string]Job)
+func (s *Scheduler) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs = make(map[string]*Job)
 }
 
 // AddJob generates a new Job struct and adds it to the key-value store of jobs
-func AddJob(id, cron, desc string, active, rerun bool, jobFunc JobFunc) error {
-	if _, ok := jobs[id]; ok {
+// Options such as WithTimeout and WithRetry configure optional behaviour of the job
+// Returns an error if the id is taken or the cron string is invalid
+func (s *Scheduler) AddJob(id, cron, desc string, active bool, jobFunc JobFunc, opts ...JobOption) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[id]; ok {
 		return fmt.Errorf("Job store already contains job with key %v", id)
 	}
-	ctx, cancel := context.WithCancel(context.Background())
-	mu := sync.Mutex{}
-	job := Job{
+	schedule, err := ParseSchedule(cron)
+	if err != nil {
+		return err
+	}
+	job := &Job{
 		ID:          id,
 		Cron:        cron,
+		schedule:    schedule,
+		clock:       s.clock,
+		store:       s.store,
+		listeners:   s.listeners,
+		health:      s.beat,
 		Description: desc,
 		Active:      active,
 		running:     false,
-		Rerun:       rerun,
-		cancel:      cancel,
-		ctx:         ctx,
-		mu:          &mu,
 		err:         nil,
 		Job:         jobFunc,
 	}
+	for _, opt := range opts {
+		opt(job)
+	}
 
-	jobs[id] = job
+	s.jobs[id] = job
 
 	return nil
 }
 
 // RemoveJob removes a job from the job map
-func RemoveJob(id string) bool {
-	if _, ok := jobs[id]; ok {
-		delete(jobs, id)
+// The job is deactivated so its queued runs and waiting retries are dropped, a run in progress finishes
+// One-shot jobs are deleted from the OneShotStore so they never run, including those this scheduler hasn't loaded,
+// such as on a replica that isn't the leader
+func (s *Scheduler) RemoveJob(id string) bool {
+	if job, ok := s.FindJob(id); (!ok || job.oneShot != nil) && s.oneShots != nil {
+		if err := s.oneShots.DeleteOneShot(id); err != nil {
+			log.Printf("Error deleting one-shot job %v: %v", id, err)
+		}
+	}
+	return s.removeJob(id)
+}
+
+// removeJob deactivates a job and removes it from the job map
+func (s *Scheduler) removeJob(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job, ok := s.jobs[id]; ok {
+		job.SetActive(false)
+		delete(s.jobs, id)
 		return true
 	}
 	return false
 }
 
+// Reschedule changes the cron string of a job, keeping the rest of its state
+// Returns an error if the job is not found or the cron string is invalid
+func (s *Scheduler) Reschedule(id, cron string) error {
+	job, ok := s.FindJob(id)
+	if !ok {
+		return fmt.Errorf("Job store does not contain job with key %v", id)
+	}
+	if job.oneShot != nil {
+		return fmt.Errorf("Job %v runs once and has no cron string", id)
+	}
+	schedule, err := ParseSchedule(cron)
+	if err != nil {
+		return err
+	}
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	job.Cron = cron
+	job.schedule = schedule
+	return nil
+}
+
 // FindJob returns a pointer to the job if ok
-func FindJob(id string) (*Job, bool) {
-	if job, ok := jobs[id]; ok {
-		return &job, true
+// Changes made through the pointer apply to the job in the store
+func (s *Scheduler) FindJob(id string) (*Job, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if job, ok := s.jobs[id]; ok {
+		return job, true
 	}
 	return nil, false
 }
 
 // IDs returns a slice all job ids in the job store
-func IDs() []string {
+func (s *Scheduler) IDs() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	jobIDs := make([]string, 0)
-	for id := range jobs {
+	for id := range s.jobs {
 		jobIDs = append(jobIDs, id)
 	}
 	return jobIDs
 }
 
 // Statuses returns a slice all job statuses in the job store
-func Statuses() []string {
+func (s *Scheduler) Statuses() []string {
 	jobList := make([]string, 0)
-	for _, job := range jobs {
+	for _, job := range s.snapshot() {
 		jobList = append(jobList, job.Status())
 	}
 	return jobList
 }
+
+// Start begins running cron jobs on the default scheduler
+// Recommended to run as a goroutine in main with a deferred Stop()
+func Start() {
+	defaultScheduler.Start()
+}
+
+// Stop will halt the default scheduler's job runner
+func Stop() {
+	defaultScheduler.Stop()
+}
+
+// Clear will empty the default scheduler's job store
+func Clear() {
+	defaultScheduler.Clear()
+}
+
+// AddJob adds a job to the default scheduler
+func AddJob(id, cron, desc string, active bool, jobFunc JobFunc, opts ...JobOption) error {
+	return defaultScheduler.AddJob(id, cron, desc, active, jobFunc, opts...)
+}
+
+// RemoveJob removes a job from the default scheduler
+func RemoveJob(id string) bool {
+	return defaultScheduler.RemoveJob(id)
+}
+
+// Reschedule changes the cron string of a job in the default scheduler
+func Reschedule(id, cron string) error {
+	return defaultScheduler.Reschedule(id, cron)
+}
+
+// FindJob returns a pointer to the default scheduler's job if ok
+func FindJob(id string) (*Job, bool) {
+	return defaultScheduler.FindJob(id)
+}
+
+// IDs returns a slice of all job ids in the default scheduler
+func IDs() []string {
+	return defaultScheduler.IDs()
+}
+
+// Statuses returns a slice of all job statuses in the default scheduler
+func Statuses() []string {
+	return defaultScheduler.Statuses()
+}
@@ -0,0 +1,988 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock whose time only moves when Advance is called
+type fakeClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*fakeWaiter
+	settle  func() // Called by Advance once a fired timer has been handled, may be nil
+}
+
+type fakeWaiter struct {
+	deadline time.Time
+	c        chan time.Time // Fired by sending the time, for After
+	f        func()         // Fired by calling it, for AfterFunc
+	stopped  bool
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	c := &fakeClock{now: now}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	c.waiters = append(c.waiters, &fakeWaiter{deadline: c.now.Add(d), c: ch})
+	c.cond.Broadcast()
+	return ch
+}
+
+// AfterFunc calls f from Advance once d has elapsed, so anything f starts is settled before time moves on
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) func() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := &fakeWaiter{deadline: c.now.Add(d), f: f}
+	c.waiters = append(c.waiters, w)
+	c.cond.Broadcast()
+	return func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		wasWaiting := !w.stopped
+		w.stopped = true
+		return wasWaiting
+	}
+}
+
+// Advance moves the clock forward by d, firing timers in order
+// Each fired timer is given time to be handled before the next fires, which requires something to be waiting on the clock
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	end := c.now.Add(d)
+	fired := false
+	for {
+		for len(c.waiters) == 0 {
+			c.cond.Wait()
+		}
+		if fired && c.settle != nil {
+			c.mu.Unlock()
+			c.settle()
+			c.mu.Lock()
+		}
+		sort.Slice(c.waiters, func(i, j int) bool { return c.waiters[i].deadline.Before(c.waiters[j].deadline) })
+		next := c.waiters[0]
+		wasStopped := next.stopped
+		if next.deadline.After(end) {
+			c.now = end
+			return
+		}
+		c.now = next.deadline
+		c.waiters = c.waiters[1:]
+		next.stopped = true
+		fired = true
+		switch {
+		case next.c != nil:
+			next.c <- c.now
+		case next.f != nil && !wasStopped:
+			c.mu.Unlock()
+			next.f()
+			c.mu.Lock()
+		}
+	}
+}
+
+// Jump moves the wall clock by d without firing timers, like a system sleep or a clock adjustment
+// Timers keep counting elapsed time, so their deadlines move with the clock
+func (c *fakeClock) Jump(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	for _, w := range c.waiters {
+		w.deadline = w.deadline.Add(d)
+	}
+}
+
+// runNow dispatches every job due at the clock's current time and waits for the runs to return
+func runNow(s *Scheduler) {
+	s.runJobs(s.clock.Now())
+	s.wg.Wait()
+}
+
+// runCounter records how many times each job ran
+type runCounter struct {
+	mu   sync.Mutex
+	runs map[string][]time.Time
+}
+
+func (r *runCounter) jobFunc(id string) JobFunc {
+	return func(ctx context.Context) error {
+		scheduled, _ := ScheduledTime(ctx)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.runs[id] = append(r.runs[id], scheduled)
+		return nil
+	}
+}
+
+func (r *runCounter) count(id string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.runs[id])
+}
+
+func TestSchedulerWeek(t *testing.T) {
+	// Monday, January 4th 2021 at midnight
+	clock := newFakeClock(time.Date(2021, time.January, 4, 0, 0, 0, 0, time.UTC))
+	s := New(clock)
+	counter := &runCounter{runs: make(map[string][]time.Time)}
+
+	tests := []struct {
+		id     string
+		cron   string
+		active bool
+		want   int
+	}{
+		{"quarter", "*/15 9-21 * * *", true, 7 * 13 * 4},
+		{"hourly", "0 9-21 * * *", true, 7 * 13},
+		{"daily", "10 10 * * *", true, 7},
+		{"weekly", "10 10 * * mon", true, 1},
+		{"midnight", "@daily", true, 7},
+		{"inactive", "* * * * *", false, 0},
+	}
+	for _, test := range tests {
+		if err := s.AddJob(test.id, test.cron, "", test.active, counter.jobFunc(test.id)); err != nil {
+			t.Fatalf("AddJob(%q) returned error %v", test.id, err)
+		}
+	}
+
+	// Let each minute's runs finish before the next tick so none are skipped as overlapping
+	clock.settle = s.wg.Wait
+	go s.Start()
+	clock.Advance(7 * 24 * time.Hour)
+	s.Stop()
+
+	for _, test := range tests {
+		if got := counter.count(test.id); got != test.want {
+			t.Errorf("job %q ran %v times, want %v", test.id, got, test.want)
+		}
+	}
+
+	wantDaily := time.Date(2021, time.January, 4, 10, 10, 0, 0, time.UTC)
+	if got := counter.runs["daily"][0]; !got.Equal(wantDaily) {
+		t.Errorf("daily job first ran at %v, want %v", got, wantDaily)
+	}
+}
+
+func TestSchedulerInstancesAreIndependent(t *testing.T) {
+	clock := newFakeClock(time.Date(2021, time.January, 4, 0, 0, 0, 0, time.UTC))
+	a, b := New(clock), New(clock)
+
+	if err := a.AddJob("1", "* * * * *", "", true, func(context.Context) error { return nil }); err != nil {
+		t.Fatalf("AddJob returned error %v", err)
+	}
+	if err := b.AddJob("1", "* * * * *", "", true, func(context.Context) error { return nil }); err != nil {
+		t.Errorf("AddJob on second scheduler returned error %v", err)
+	}
+	if !a.RemoveJob("1") {
+		t.Errorf("RemoveJob(%q) = false", "1")
+	}
+	if len(a.IDs()) != 0 || len(b.IDs()) != 1 {
+		t.Errorf("schedulers share jobs: %v, %v", a.IDs(), b.IDs())
+	}
+}
+
+func TestAddJobInvalidCron(t *testing.T) {
+	s := New(RealClock())
+	if err := s.AddJob("1", "* * * JAN-", "", true, nil); err == nil {
+		t.Errorf("AddJob with invalid cron returned no error")
+	}
+	if len(s.IDs()) != 0 {
+		t.Errorf("invalid job was added to the store")
+	}
+}
+
+func TestReschedule(t *testing.T) {
+	clock := newFakeClock(time.Date(2021, time.January, 4, 9, 0, 0, 0, time.UTC))
+	s := New(clock)
+	runs := 0
+	if err := s.AddJob("1", "0 * * * *", "", true, func(context.Context) error {
+		runs++
+		return nil
+	}); err != nil {
+		t.Fatalf("AddJob returned error %v", err)
+	}
+	runNow(s)
+
+	if err := s.Reschedule("1", "* * * JAN-"); err == nil {
+		t.Errorf("Reschedule with invalid cron returned no error")
+	}
+	if err := s.Reschedule("2", "* * * * *"); err == nil {
+		t.Errorf("Reschedule of unknown job returned no error")
+	}
+	if err := s.Reschedule("1", "30 9 * * *"); err != nil {
+		t.Fatalf("Reschedule returned error %v", err)
+	}
+
+	job, _ := s.FindJob("1")
+	if got := job.Schedule().String(); got != "30 9 * * *" {
+		t.Errorf("Schedule() = %q, want %q", got, "30 9 * * *")
+	}
+	want := time.Date(2021, time.January, 4, 9, 30, 0, 0, time.UTC)
+	if got := job.NextRun(); !got.Equal(want) {
+		t.Errorf("NextRun() = %v, want %v", got, want)
+	}
+	// State survives the new schedule
+	if runs != 1 || job.LastRun().IsZero() {
+		t.Errorf("job state lost after Reschedule: %v runs, last run %v", runs, job.LastRun())
+	}
+}
+
+func TestRemoveJobDeactivates(t *testing.T) {
+	s := New(RealClock())
+	if err := s.AddJob("1", "* * * * *", "", true, func(context.Context) error { return nil }); err != nil {
+		t.Fatalf("AddJob returned error %v", err)
+	}
+	job, _ := s.FindJob("1")
+	if !s.RemoveJob("1") {
+		t.Fatalf("RemoveJob(%q) = false, want true", "1")
+	}
+	if job.Active {
+		t.Errorf("removed job is still active")
+	}
+	if _, ok := s.FindJob("1"); ok {
+		t.Errorf("removed job is still in the store")
+	}
+}
+
+func TestJobStatePersists(t *testing.T) {
+	clock := newFakeClock(time.Date(2021, time.January, 4, 0, 0, 0, 0, time.UTC))
+	s := New(clock)
+	runs := 0
+	jobErr := errors.New("twilio is down")
+	if err := s.AddJob("1", "* * * * *", "", true, func(context.Context) error {
+		runs++
+		return jobErr
+	}); err != nil {
+		t.Fatalf("AddJob returned error %v", err)
+	}
+
+	runNow(s)
+	job, ok := s.FindJob("1")
+	if !ok {
+		t.Fatalf("FindJob(%q) not found", "1")
+	}
+	if job.err != jobErr {
+		t.Errorf("job error = %v, want %v", job.err, jobErr)
+	}
+	if job.running {
+		t.Errorf("job is still marked running after it returned")
+	}
+	if !strings.Contains(job.Status(), jobErr.Error()) {
+		t.Errorf("Status() = %q, missing error", job.Status())
+	}
+
+	// Deactivating through FindJob stops the job from running
+	job.SetActive(false)
+	runNow(s)
+	if runs != 1 {
+		t.Errorf("inactive job ran, total runs %v", runs)
+	}
+}
+
+func TestConcurrentStoreAccess(t *testing.T) {
+	clock := newFakeClock(time.Date(2021, time.January, 4, 0, 0, 0, 0, time.UTC))
+	s := New(clock)
+	var wg sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		id := fmt.Sprint(i)
+		wg.Add(4)
+		go func() {
+			defer wg.Done()
+			s.AddJob(id, "* * * * *", "", true, func(context.Context) error { return nil })
+		}()
+		go func() {
+			defer wg.Done()
+			s.runJobs(clock.Now())
+		}()
+		go func() {
+			defer wg.Done()
+			if job, ok := s.FindJob(id); ok {
+				job.SetActive(false)
+				job.Status()
+			}
+			s.Statuses()
+		}()
+		go func() {
+			defer wg.Done()
+			s.RemoveJob(id)
+			s.IDs()
+		}()
+	}
+	wg.Wait()
+	s.wg.Wait()
+}
+
+func TestWorkerPoolBoundsConcurrency(t *testing.T) {
+	clock := newFakeClock(time.Date(2021, time.January, 4, 0, 0, 0, 0, time.UTC))
+	s := New(clock, WithWorkers(2))
+
+	var mu sync.Mutex
+	current, peak := 0, 0
+	release := make(chan struct{})
+	started := make(chan struct{}, 5)
+	for i := 0; i < 5; i++ {
+		s.AddJob(fmt.Sprint(i), "* * * * *", "", true, func(context.Context) error {
+			mu.Lock()
+			current++
+			if current > peak {
+				peak = current
+			}
+			mu.Unlock()
+			started <- struct{}{}
+			<-release
+			mu.Lock()
+			current--
+			mu.Unlock()
+			return nil
+		})
+	}
+
+	// runJobs must not wait for the jobs to finish
+	s.runJobs(clock.Now())
+	<-started
+	<-started
+	close(release)
+	s.wg.Wait()
+
+	if peak != 2 {
+		t.Errorf("peak concurrent jobs = %v, want 2", peak)
+	}
+	if len(started) != 3 {
+		t.Errorf("%v jobs ran after release, want 3", len(started))
+	}
+}
+
+func TestOverlapPolicies(t *testing.T) {
+	tests := []struct {
+		policy      OverlapPolicy
+		wantRuns    int
+		wantSkipped int
+		wantFirst   error
+	}{
+		{OverlapSkip, 1, 1, nil},
+		{OverlapQueue, 2, 0, nil},
+		{OverlapCancel, 2, 0, ErrCancelled},
+	}
+
+	for _, test := range tests {
+		start := time.Date(2021, time.January, 4, 10, 10, 0, 0, time.UTC)
+		clock := newFakeClock(start)
+		s := New(clock)
+		release := make(chan struct{})
+		started := make(chan time.Time, 2)
+		errs := make(chan error, 2)
+		s.AddJob("1", "* * * * *", "", true, func(ctx context.Context) error {
+			scheduled, _ := ScheduledTime(ctx)
+			started <- scheduled
+			select {
+			case <-release:
+				errs <- nil
+				return nil
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return ctx.Err()
+			}
+		}, WithOverlap(test.policy))
+		job, _ := s.FindJob("1")
+
+		s.runJobs(start)
+		<-started
+		s.runJobs(start.Add(time.Minute))
+
+		// The first run is cancelled by the second when using OverlapCancel, otherwise it finishes normally
+		if test.wantFirst != nil {
+			if first := <-errs; first == nil {
+				t.Errorf("policy %v: first run was not cancelled", test.policy)
+			}
+		}
+		close(release)
+		if test.wantRuns == 2 {
+			if got := <-started; !got.Equal(start.Add(time.Minute)) {
+				t.Errorf("policy %v: queued run scheduled for %v, want %v", test.policy, got, start.Add(time.Minute))
+			}
+		}
+		s.wg.Wait()
+
+		metrics := job.Metrics()
+		if metrics.Runs != test.wantRuns || metrics.Skipped != test.wantSkipped {
+			t.Errorf("policy %v: runs %v skipped %v, want %v and %v", test.policy, metrics.Runs, metrics.Skipped, test.wantRuns, test.wantSkipped)
+		}
+		if test.wantFirst == nil {
+			if first := <-errs; first != nil {
+				t.Errorf("policy %v: first run returned %v", test.policy, first)
+			}
+		}
+	}
+}
+
+func TestStartDelayMetrics(t *testing.T) {
+	clock := newFakeClock(time.Date(2021, time.January, 4, 10, 10, 5, 0, time.UTC))
+	s := New(clock)
+	s.AddJob("1", "10 10 * * *", "", true, func(context.Context) error { return nil })
+	job, _ := s.FindJob("1")
+
+	s.runJobs(time.Date(2021, time.January, 4, 10, 10, 0, 0, time.UTC))
+	s.wg.Wait()
+
+	metrics := job.Metrics()
+	if metrics.Runs != 1 || metrics.LastDelay != 5*time.Second || metrics.MaxDelay != 5*time.Second {
+		t.Errorf("metrics = %+v, want one run 5s late", metrics)
+	}
+	if !strings.Contains(job.Status(), "started 5s late") {
+		t.Errorf("Status() = %q, missing start delay", job.Status())
+	}
+}
+
+// memStore is an in-memory Store
+type memStore struct {
+	mu       sync.Mutex
+	lastRuns map[string]time.Time
+}
+
+func newMemStore() *memStore {
+	return &memStore{lastRuns: make(map[string]time.Time)}
+}
+
+func (m *memStore) LastRun(id string) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lastRuns[id], nil
+}
+
+func (m *memStore) SaveLastRun(id string, scheduled time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastRuns[id] = scheduled
+	return nil
+}
+
+func TestJitterRunsOncePerWindow(t *testing.T) {
+	clock := newFakeClock(time.Date(2021, time.January, 4, 8, 59, 30, 0, time.UTC))
+	s := New(clock)
+	var ranAt []time.Time
+	s.AddJob("1", "0 9 * * *", "", true, func(ctx context.Context) error {
+		ranAt = append(ranAt, clock.Now())
+		return nil
+	}, WithJitter(12*time.Hour))
+	job, _ := s.FindJob("1")
+
+	want := job.NextRun()
+	windowStart := time.Date(2021, time.January, 4, 9, 0, 0, 0, time.UTC)
+	if want.Before(windowStart) || !want.Before(windowStart.Add(12*time.Hour)) {
+		t.Fatalf("NextRun() = %v, want within 12 hours of %v", want, windowStart)
+	}
+	if other, _ := s.FindJob("1"); !other.NextRun().Equal(want) {
+		t.Errorf("NextRun() changed between calls")
+	}
+
+	clock.settle = s.wg.Wait
+	go s.Start()
+	clock.Advance(24 * time.Hour)
+	s.Stop()
+
+	if len(ranAt) != 1 || !ranAt[0].Equal(want) {
+		t.Errorf("job ran at %v, want once at %v", ranAt, want)
+	}
+	if m := job.Metrics(); m.LastDelay != 0 {
+		t.Errorf("jitter counted as start delay %v", m.LastDelay)
+	}
+}
+
+func TestJitterPendingAfterRestart(t *testing.T) {
+	// Server restarted half a minute into the window, before the run's random time
+	scheduled := time.Date(2021, time.January, 4, 9, 0, 0, 0, time.UTC)
+	restart := scheduled.Add(30 * time.Second)
+	store := newMemStore()
+	store.SaveLastRun("1", scheduled.AddDate(0, 0, -1))
+
+	clock := newFakeClock(restart)
+	s := New(clock, WithStore(store))
+	counter := &runCounter{runs: make(map[string][]time.Time)}
+	s.AddJob("1", "0 9 * * *", "", true, counter.jobFunc("1"), WithJitter(12*time.Hour))
+	job, _ := s.FindJob("1")
+	if !scheduled.Add(job.jitter(scheduled)).After(restart) {
+		t.Fatalf("jitter of %v falls before the restart", job.jitter(scheduled))
+	}
+
+	clock.settle = s.wg.Wait
+	go s.Start()
+	clock.Advance(12 * time.Hour)
+	s.Stop()
+
+	if got := counter.runs["1"]; len(got) != 1 || !got[0].Equal(scheduled) {
+		t.Errorf("job ran for %v, want once for %v", got, scheduled)
+	}
+
+	// Restarting again in the same window doesn't repeat the run
+	s = New(newFakeClock(restart), WithStore(store))
+	s.AddJob("1", "0 9 * * *", "", true, counter.jobFunc("1"), WithJitter(12*time.Hour))
+	s.catchUp(restart)
+	job, _ = s.FindJob("1")
+	if next := job.NextRun(); !next.After(scheduled.AddDate(0, 0, 1)) {
+		t.Errorf("NextRun() = %v after the window's run succeeded, want the next day", next)
+	}
+}
+
+// eventRecorder is a Listener that records the events it is told about
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []string
+	last   map[string]Event
+}
+
+func (r *eventRecorder) record(kind string, e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, fmt.Sprintf("%s %v", kind, e.Attempt))
+	r.last[kind] = e
+}
+
+func (r *eventRecorder) OnScheduled(e Event) { r.record("scheduled", e) }
+func (r *eventRecorder) OnStart(e Event)     { r.record("start", e) }
+func (r *eventRecorder) OnSuccess(e Event)   { r.record("success", e) }
+func (r *eventRecorder) OnError(e Event)     { r.record("error", e) }
+func (r *eventRecorder) OnSkipped(e Event)   { r.record("skipped", e) }
+
+func TestListener(t *testing.T) {
+	scheduled := time.Date(2021, time.January, 4, 10, 10, 0, 0, time.UTC)
+	clock := newFakeClock(scheduled)
+	recorder := &eventRecorder{last: make(map[string]Event)}
+	s := New(clock, WithListener(recorder))
+	jobErr := errors.New("twilio is down")
+	attempts := 0
+	s.AddJob("1", "10 10 * * *", "", true, func(ctx context.Context) error {
+		attempts++
+		if attempts == 1 {
+			return jobErr
+		}
+		return nil
+	}, WithRetry(RetryPolicy{MaxAttempts: 2, InitialDelay: time.Second}))
+
+	runNow(s)
+	clock.settle = s.wg.Wait
+	go s.Start()
+	clock.Advance(time.Second)
+	s.Stop()
+
+	// A due run is skipped while the job is still running
+	job, _ := s.FindJob("1")
+	job.running = true
+	s.runJobs(scheduled.AddDate(0, 0, 1))
+
+	want := []string{"scheduled 1", "start 1", "error 1", "scheduled 2", "start 2", "success 2", "skipped 0"}
+	if fmt.Sprint(recorder.events) != fmt.Sprint(want) {
+		t.Errorf("events = %v, want %v", recorder.events, want)
+	}
+	if e := recorder.last["error"]; e.JobID != "1" || !e.Scheduled.Equal(scheduled) || !errors.Is(e.Err, jobErr) || !e.RetryAt.Equal(scheduled.Add(time.Second)) {
+		t.Errorf("OnError got %+v", e)
+	}
+	if e := recorder.last["success"]; !e.Scheduled.Equal(scheduled) || e.Outcome != OutcomeSuccess || !e.RetryAt.IsZero() {
+		t.Errorf("OnSuccess got %+v", e)
+	}
+	if e := recorder.last["skipped"]; e.Reason != "the previous run was still going" {
+		t.Errorf("OnSkipped reason = %q", e.Reason)
+	}
+}
+
+// fakeLeader is a Leader that leads when told to
+type fakeLeader struct {
+	mu       sync.Mutex
+	leading  bool
+	resigned bool
+}
+
+func (l *fakeLeader) Lead() (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.leading, nil
+}
+
+func (l *fakeLeader) Resign() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.leading, l.resigned = false, true
+	return nil
+}
+
+func (l *fakeLeader) set(leading bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.leading = leading
+}
+
+func TestLeaderElection(t *testing.T) {
+	start := time.Date(2021, time.January, 4, 10, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+	store := newMemStore()
+	leader := &fakeLeader{}
+	s := New(clock, WithStore(store), WithLeader(leader))
+	counter := &runCounter{runs: make(map[string][]time.Time)}
+	s.AddJob("send", "*/10 * * * *", "", true, counter.jobFunc("send"), WithCatchUp(CatchUpOnce, 0))
+	s.AddJob("sync", "* * * * *", "", true, counter.jobFunc("sync"), WithAllReplicas())
+
+	// Another replica leads and sends at 10:00 and 10:10
+	store.SaveLastRun("send", start.Add(10*time.Minute))
+
+	clock.settle = s.wg.Wait
+	go s.Start()
+	clock.Advance(20 * time.Minute)
+	if got := counter.runs["send"]; len(got) != 0 {
+		t.Errorf("follower ran job for %v", got)
+	}
+	if got := counter.runs["sync"]; len(got) != 20 {
+		t.Errorf("job on every replica ran %v times as follower, want 20", len(got))
+	}
+
+	// The other replica died after 10:10, this one takes over at 10:21 and catches up on 10:20
+	leader.set(true)
+	clock.Advance(10 * time.Minute)
+	s.Stop()
+
+	want := []time.Time{
+		time.Date(2021, time.January, 4, 10, 20, 0, 0, time.UTC),
+		time.Date(2021, time.January, 4, 10, 30, 0, 0, time.UTC),
+	}
+	got := counter.runs["send"]
+	if len(got) != len(want) {
+		t.Fatalf("leader ran job for %v, want %v", got, want)
+	}
+	for i := range got {
+		if !got[i].Equal(want[i]) {
+			t.Errorf("leader ran job for %v, want %v", got, want)
+		}
+	}
+	if !leader.resigned {
+		t.Errorf("Stop did not resign leadership")
+	}
+}
+
+// holiday blacks out every time from start until end
+type holiday struct {
+	start, end time.Time
+}
+
+func (h holiday) BlackedOut(t time.Time) (time.Time, string, error) {
+	if t.Before(h.start) || !t.Before(h.end) {
+		return time.Time{}, "", nil
+	}
+	return h.end, "holiday", nil
+}
+
+func TestBlackout(t *testing.T) {
+	start := time.Date(2021, time.December, 25, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2021, time.December, 25, 12, 0, 0, 0, time.UTC)
+	scheduled := time.Date(2021, time.December, 25, 10, 10, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		policy BlackoutPolicy
+		status string
+		want   []time.Time // Times the job ran
+	}{
+		{"skip", BlackoutSkip, "skipped by a blackout: holiday", nil},
+		{"defer", BlackoutDefer, "deferred until today at 12:00 by a blackout: holiday", []time.Time{end}},
+	}
+
+	for _, test := range tests {
+		clock := newFakeClock(scheduled.Add(-30 * time.Second))
+		s := New(clock)
+		var ranAt []time.Time
+		s.AddJob("1", "10 10 * * *", "", true, func(context.Context) error {
+			ranAt = append(ranAt, clock.Now())
+			return nil
+		}, WithBlackout(holiday{start, end}, test.policy))
+		job, _ := s.FindJob("1")
+
+		clock.settle = s.wg.Wait
+		go s.Start()
+		clock.Advance(time.Minute)
+		if status := job.Status(); !strings.Contains(status, test.status) {
+			t.Errorf("%s: Status() = %q, missing %q", test.name, status, test.status)
+		}
+		clock.Advance(3 * time.Hour)
+		s.Stop()
+
+		if len(ranAt) != len(test.want) {
+			t.Errorf("%s: job ran at %v, want %v", test.name, ranAt, test.want)
+			continue
+		}
+		for i := range ranAt {
+			if !ranAt[i].Equal(test.want[i]) {
+				t.Errorf("%s: job ran at %v, want %v", test.name, ranAt, test.want)
+			}
+		}
+		if m := job.Metrics(); m.Suppressed != 1 {
+			t.Errorf("%s: %v runs suppressed, want 1", test.name, m.Suppressed)
+		}
+	}
+}
+
+func TestCatchUp(t *testing.T) {
+	// Server was down from Monday 10:00 until Wednesday 12:00
+	lastRun := time.Date(2021, time.January, 4, 10, 10, 0, 0, time.UTC)
+	restart := time.Date(2021, time.January, 6, 12, 0, 30, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		cron     string
+		policy   CatchUpPolicy
+		lookback time.Duration
+		want     []time.Time
+	}{
+		{"skip", "10 10 * * *", CatchUpSkip, 0, nil},
+		{"once", "10 10 * * *", CatchUpOnce, 72 * time.Hour, []time.Time{
+			time.Date(2021, time.January, 6, 10, 10, 0, 0, time.UTC),
+		}},
+		{"all", "10 10 * * *", CatchUpAll, 72 * time.Hour, []time.Time{
+			time.Date(2021, time.January, 5, 10, 10, 0, 0, time.UTC),
+			time.Date(2021, time.January, 6, 10, 10, 0, 0, time.UTC),
+		}},
+		{"lookback", "10 10 * * *", CatchUpAll, 0, []time.Time{
+			time.Date(2021, time.January, 6, 10, 10, 0, 0, time.UTC),
+		}},
+		{"current minute", "0 12 * * *", CatchUpAll, 0, []time.Time{
+			time.Date(2021, time.January, 6, 12, 0, 0, 0, time.UTC),
+		}},
+		{"none missed", "10 10 * * mon", CatchUpAll, 72 * time.Hour, nil},
+	}
+
+	for _, test := range tests {
+		store := newMemStore()
+		store.SaveLastRun(test.name, lastRun)
+		s := New(newFakeClock(restart), WithStore(store))
+		counter := &runCounter{runs: make(map[string][]time.Time)}
+		s.AddJob(test.name, test.cron, "", true, counter.jobFunc(test.name), WithCatchUp(test.policy, test.lookback))
+
+		s.catchUp(restart)
+		s.wg.Wait()
+
+		got := counter.runs[test.name]
+		if len(got) != len(test.want) {
+			t.Errorf("%s: caught up %v, want %v", test.name, got, test.want)
+			continue
+		}
+		for i := range got {
+			if !got[i].Equal(test.want[i]) {
+				t.Errorf("%s: caught up %v, want %v", test.name, got, test.want)
+				break
+			}
+		}
+		if len(test.want) > 0 {
+			if saved, _ := store.LastRun(test.name); !saved.Equal(test.want[len(test.want)-1]) {
+				t.Errorf("%s: saved last run %v, want %v", test.name, saved, test.want[len(test.want)-1])
+			}
+		}
+	}
+}
+
+func TestFailedRunIsNotSaved(t *testing.T) {
+	store := newMemStore()
+	clock := newFakeClock(time.Date(2021, time.January, 4, 10, 10, 0, 0, time.UTC))
+	s := New(clock, WithStore(store))
+	s.AddJob("1", "* * * * *", "", true, func(context.Context) error { return errors.New("failed") })
+
+	runNow(s)
+	if saved, _ := store.LastRun("1"); !saved.IsZero() {
+		t.Errorf("failed run was saved as last run %v", saved)
+	}
+}
+
+// memHistory is an in-memory History
+type memHistory struct {
+	mu   sync.Mutex
+	runs []Run
+}
+
+func (h *memHistory) RecordRun(run Run) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.runs = append(h.runs, run)
+	return nil
+}
+
+func TestHistoryRecordsRuns(t *testing.T) {
+	history := &memHistory{}
+	clock := newFakeClock(time.Date(2021, time.January, 4, 10, 10, 0, 0, time.UTC))
+	s := New(clock, WithHistory(history))
+	jobErr := errors.New("bad number")
+	s.AddJob("ok", "* * * * *", "", true, func(ctx context.Context) error {
+		AddCount(ctx, 2)
+		AddCount(ctx, 1)
+		return nil
+	})
+	s.AddJob("failed", "* * * * *", "", true, func(ctx context.Context) error {
+		AddCount(ctx, 1)
+		return jobErr
+	})
+	s.AddJob("slow", "* * * * *", "", true, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, WithTimeout(time.Millisecond))
+
+	runNow(s)
+
+	want := map[string]struct {
+		outcome Outcome
+		count   int
+	}{
+		"ok":     {OutcomeSuccess, 3},
+		"failed": {OutcomeError, 1},
+		"slow":   {OutcomeTimeout, 0},
+	}
+	if len(history.runs) != len(want) {
+		t.Fatalf("recorded %v runs, want %v", len(history.runs), len(want))
+	}
+	for _, run := range history.runs {
+		w := want[run.JobID]
+		if run.Outcome != w.outcome || run.Count != w.count {
+			t.Errorf("run of %q recorded as %v with count %v, want %v with count %v", run.JobID, run.Outcome, run.Count, w.outcome, w.count)
+		}
+		if !run.Scheduled.Equal(clock.Now()) {
+			t.Errorf("run of %q scheduled for %v, want %v", run.JobID, run.Scheduled, clock.Now())
+		}
+	}
+}
+
+func TestLocation(t *testing.T) {
+	toronto, err := time.LoadLocation("America/Toronto")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	// Midnight in Toronto on November 7th 2021, the day clocks go back an hour
+	clock := newFakeClock(time.Date(2021, time.November, 7, 4, 0, 0, 0, time.UTC))
+	s := New(clock)
+	counter := &runCounter{runs: make(map[string][]time.Time)}
+	s.AddJob("toronto", "10 10 * * *", "", true, counter.jobFunc("toronto"), WithLocation(toronto))
+	s.AddJob("repeated", "30 1 * * *", "", true, counter.jobFunc("repeated"), WithLocation(toronto))
+	s.AddJob("utc", "10 10 * * *", "", true, counter.jobFunc("utc"))
+
+	job, _ := s.FindJob("toronto")
+	want := time.Date(2021, time.November, 7, 15, 10, 0, 0, time.UTC)
+	if got := job.NextRun(); !got.Equal(want) {
+		t.Errorf("NextRun() = %v, want %v", got, want)
+	}
+
+	clock.settle = s.wg.Wait
+	go s.Start()
+	clock.Advance(24 * time.Hour)
+	s.Stop()
+
+	wants := map[string][]time.Time{
+		"toronto":  {want},
+		"repeated": {time.Date(2021, time.November, 7, 5, 30, 0, 0, time.UTC)},
+		"utc":      {time.Date(2021, time.November, 7, 10, 10, 0, 0, time.UTC)},
+	}
+	for id, want := range wants {
+		counter.mu.Lock()
+		got := counter.runs[id]
+		counter.mu.Unlock()
+		if len(got) != len(want) || !got[0].Equal(want[0]) {
+			t.Errorf("job %q ran for %v, want %v", id, got, want)
+		}
+	}
+}
+
+func TestTicksAlignToMinutes(t *testing.T) {
+	clock := newFakeClock(time.Date(2021, time.January, 4, 10, 9, 45, 500, time.UTC))
+	s := New(clock)
+	var mu sync.Mutex
+	ticks := make([]time.Time, 0)
+	s.AddJob("1", "* * * * *", "", true, func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		ticks = append(ticks, clock.Now())
+		return nil
+	})
+
+	clock.settle = s.wg.Wait
+	go s.Start()
+	clock.Advance(2 * time.Minute)
+	s.Stop()
+
+	want := []time.Time{time.Date(2021, time.January, 4, 10, 10, 0, 0, time.UTC), time.Date(2021, time.January, 4, 10, 11, 0, 0, time.UTC)}
+	if fmt.Sprint(ticks) != fmt.Sprint(want) {
+		t.Errorf("job ran at %v, want %v", ticks, want)
+	}
+}
+
+func TestClockJumps(t *testing.T) {
+	start := time.Date(2021, time.January, 4, 10, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+	s := New(clock)
+	counter := &runCounter{runs: make(map[string][]time.Time)}
+	s.AddJob("1", "* * * * *", "", true, counter.jobFunc("1"), WithCatchUp(CatchUpAll, time.Hour))
+
+	clock.settle = s.wg.Wait
+	go s.Start()
+	clock.Advance(time.Minute)
+	// A short sleep, the skipped minutes are caught up when the clock is back
+	clock.Jump(3 * time.Minute)
+	clock.Advance(time.Minute)
+	// The clock goes back, the minutes already run are not run again
+	clock.Jump(-90 * time.Second)
+	clock.Advance(2 * time.Minute)
+	h := s.Health()
+	s.Stop()
+
+	want := make([]time.Time, 0)
+	for i := 1; i <= 5; i++ {
+		want = append(want, start.Add(time.Duration(i)*time.Minute))
+	}
+	if got := counter.runs["1"]; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("job ran for %v, want %v", got, want)
+	}
+	if h.Skipped != 3 || h.Repeated != 2 {
+		t.Errorf("Health() = %+v, want 3 minutes skipped and 2 ticks repeated", h)
+	}
+}
+
+func TestLongClockJumpCatchesUp(t *testing.T) {
+	start := time.Date(2021, time.January, 4, 10, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+	s := New(clock)
+	counter := &runCounter{runs: make(map[string][]time.Time)}
+	s.AddJob("skip", "* * * * *", "", true, counter.jobFunc("skip"))
+	s.AddJob("all", "* * * * *", "", true, counter.jobFunc("all"), WithCatchUp(CatchUpAll, 5*time.Minute))
+
+	clock.settle = s.wg.Wait
+	go s.Start()
+	clock.Advance(time.Minute)
+	// The system sleeps for two hours, each job catches up by its own policy
+	clock.Jump(2 * time.Hour)
+	clock.Advance(time.Minute)
+	s.Stop()
+
+	if got := counter.count("skip"); got != 2 {
+		t.Errorf("job without catch up ran %v times, want 2", got)
+	}
+	// Five minutes of catch up up to and including the tick's minute, which isn't run twice
+	want := []time.Time{start.Add(time.Minute)}
+	for i := 4; i >= 0; i-- {
+		want = append(want, start.Add(2*time.Hour+2*time.Minute-time.Duration(i)*time.Minute))
+	}
+	if got := counter.runs["all"]; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("job catching up all runs ran for %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,19 @@
+package scheduler
+
+import "time"
+
+// Store persists job state so it survives restarts
+// Implementations must be safe for concurrent use
+type Store interface {
+	// LastRun returns the scheduled minute of the job's last successful run, or the zero time if there is none
+	LastRun(id string) (time.Time, error)
+	// SaveLastRun records the scheduled minute of the job's last successful run
+	SaveLastRun(id string, scheduled time.Time) error
+}
+
+// WithStore persists each job's last successful run so missed runs can be caught up after a restart
+func WithStore(store Store) Option {
+	return func(s *Scheduler) {
+		s.store = store
+	}
+}
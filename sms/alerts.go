@@ -0,0 +1,71 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mdesson/CatFactsForever/scheduler"
+)
+
+// AdminAlerts is a scheduler listener that texts the admins when a job fails and won't be retried
+// A job is only alerted on once until it succeeds again, so a broken job doesn't flood the admins
+type AdminAlerts struct {
+	scheduler.NopListener
+	mu      sync.Mutex
+	failing map[string]bool // Jobs already alerted on since their last success
+}
+
+// OnSuccess lets the job be alerted on again
+func (a *AdminAlerts) OnSuccess(e scheduler.Event) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.failing, e.JobID)
+}
+
+// OnError texts the admins once the job has run out of retries
+func (a *AdminAlerts) OnError(e scheduler.Event) {
+	if !e.RetryAt.IsZero() {
+		return
+	}
+	a.mu.Lock()
+	if a.failing == nil {
+		a.failing = make(map[string]bool)
+	}
+	alerted := a.failing[e.JobID]
+	a.failing[e.JobID] = true
+	a.mu.Unlock()
+	if alerted {
+		return
+	}
+
+	AlertAdmins(fmt.Sprintf("CAT FACTS job %v failed after %v attempts: %v", e.JobID, e.Attempt, e.Err))
+}
+
+// alertTimeout bounds how long texting the admins an alert may take
+const alertTimeout = 30 * time.Second
+
+// pendingAlerts tracks alerts still being sent, so tests can wait for them
+var pendingAlerts sync.WaitGroup
+
+// AlertAdmins texts a message to both admins in the background, so a slow or hung provider can't hold up
+// the job worker or watchdog raising the alert
+func AlertAdmins(msg string) {
+	pendingAlerts.Add(1)
+	go func() {
+		defer pendingAlerts.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), alertTimeout)
+		defer cancel()
+		for _, phone := range []string{os.Getenv("ADMIN_PHONE_1"), os.Getenv("ADMIN_PHONE_2")} {
+			if phone == "" {
+				continue
+			}
+			if _, err := SendText(ctx, msg, phone); err != nil {
+				log.Printf("Error alerting admin %v: %v: %v", phone, err, msg)
+			}
+		}
+	}()
+}
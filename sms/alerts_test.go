@@ -0,0 +1,82 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mdesson/CatFactsForever/scheduler"
+)
+
+// useAdmins sets the admins' phone numbers and the Sender for a test, returning a function that restores them
+func useAdmins(s Sender) func() {
+	old1, old2, oldSender := os.Getenv("ADMIN_PHONE_1"), os.Getenv("ADMIN_PHONE_2"), sender
+	os.Setenv("ADMIN_PHONE_1", "+15145550001")
+	os.Setenv("ADMIN_PHONE_2", "+15145550002")
+	SetSender(s)
+	return func() {
+		os.Setenv("ADMIN_PHONE_1", old1)
+		os.Setenv("ADMIN_PHONE_2", old2)
+		SetSender(oldSender)
+	}
+}
+
+// hungSender is a Sender whose sends hang until their context ends or the channel is closed
+type hungSender chan struct{}
+
+func (h hungSender) Send(ctx context.Context, msg Message) (Result, error) {
+	select {
+	case <-ctx.Done():
+		return Result{}, ctx.Err()
+	case <-h:
+		return Result{}, errors.New("hung up")
+	}
+}
+
+func TestAdminAlerts(t *testing.T) {
+	fake := &Fake{}
+	defer useAdmins(fake)()
+	alerts := &AdminAlerts{}
+	failed := scheduler.Event{Run: scheduler.Run{JobID: "3", Err: errors.New("twilio is down")}, Attempt: 3}
+
+	// Runs that will be retried aren't alerted on
+	alerts.OnError(scheduler.Event{Run: scheduler.Run{JobID: "3", Err: errors.New("twilio is down")}, Attempt: 1, RetryAt: time.Now()})
+	alerts.OnError(failed)
+	// A job is alerted on once until it succeeds again
+	alerts.OnError(failed)
+	alerts.OnSuccess(scheduler.Event{Run: scheduler.Run{JobID: "3"}})
+	alerts.OnError(failed)
+	pendingAlerts.Wait()
+
+	messages := fake.Messages()
+	if len(messages) != 4 {
+		t.Fatalf("sent %v alerts, want 2 to each admin: %+v", len(messages), messages)
+	}
+	if messages[0].To != "+15145550001" || messages[1].To != "+15145550002" {
+		t.Errorf("alerted %v and %v, want both admins", messages[0].To, messages[1].To)
+	}
+	if want := "CAT FACTS job 3 failed after 3 attempts: twilio is down"; messages[0].Body != want {
+		t.Errorf("alerted %q, want %q", messages[0].Body, want)
+	}
+}
+
+func TestAlertAdminsDoesNotBlock(t *testing.T) {
+	hung := make(hungSender)
+	defer useAdmins(hung)()
+	// The alert finishes before the next test changes the Sender
+	defer pendingAlerts.Wait()
+	defer close(hung)
+
+	done := make(chan struct{})
+	go func() {
+		(&AdminAlerts{}).OnError(scheduler.Event{Run: scheduler.Run{JobID: "3", Err: errors.New("twilio is down")}, Attempt: 3})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("OnError is blocked on a hung provider")
+	}
+}
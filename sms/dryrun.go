@@ -0,0 +1,36 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// DryRun is a Sender that writes messages to a file or the console instead of sending them
+type DryRun struct {
+	mu   sync.Mutex
+	Out  io.Writer // Where messages are written, such as os.Stdout or a log file
+	From string    // Phone number shown as the sender of messages without one
+	sent int
+}
+
+// Send writes the message to d.Out
+func (d *DryRun) Send(ctx context.Context, msg Message) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+	from := msg.From
+	if from == "" {
+		from = d.From
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, err := fmt.Fprintf(d.Out, "%v text from %v to %v:\n%v\n\n", time.Now().Format("Mon Jan 2 15:04:05"), from, msg.To, msg.Body); err != nil {
+		return Result{}, fmt.Errorf("Error writing dry run text: %v", err)
+	}
+	d.sent++
+	return Result{ID: fmt.Sprintf("dry-run-%v", d.sent), Status: "sent"}, nil
+}
@@ -0,0 +1,45 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	out := &bytes.Buffer{}
+	dryRun := &DryRun{Out: out, From: "+15145550000"}
+
+	result, err := dryRun.Send(context.Background(), Message{To: "+15145551234", Body: "Cats sleep 16 hours a day"})
+	if err != nil {
+		t.Fatalf("Send() returned error %v", err)
+	}
+	if result != (Result{ID: "dry-run-1", Status: "sent"}) {
+		t.Errorf("Send() = %+v, want the first dry run ID", result)
+	}
+	if want := " text from +15145550000 to +15145551234:\nCats sleep 16 hours a day\n\n"; !strings.HasSuffix(out.String(), want) {
+		t.Errorf("wrote %q, want it to end with %q", out.String(), want)
+	}
+
+	// Messages can be sent from another number
+	out.Reset()
+	result, err = dryRun.Send(context.Background(), Message{To: "+15145551234", From: "+15145559999", Body: "meow"})
+	if err != nil || result.ID != "dry-run-2" {
+		t.Errorf("Send() = %+v, %v, want the second dry run ID", result, err)
+	}
+	if !strings.Contains(out.String(), "from +15145559999 to") {
+		t.Errorf("wrote %q, want it sent from the message's number", out.String())
+	}
+
+	// Nothing is written once the context is done
+	out.Reset()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := dryRun.Send(ctx, Message{To: "+15145551234", Body: "meow"}); err != context.Canceled {
+		t.Errorf("Send() with a cancelled context returned %v, want context.Canceled", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("wrote %q with a cancelled context", out.String())
+	}
+}
@@ -0,0 +1,37 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Fake is a Sender that keeps messages in memory instead of sending them, for tests
+type Fake struct {
+	mu       sync.Mutex
+	messages []Message
+	Fail     func(Message) error // Decides which messages fail instead of being recorded, none if nil
+}
+
+// Send records the message, or fails with the error f.Fail returns for it
+func (f *Fake) Send(ctx context.Context, msg Message) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Fail != nil {
+		if err := f.Fail(msg); err != nil {
+			return Result{}, err
+		}
+	}
+	f.messages = append(f.messages, msg)
+	return Result{ID: fmt.Sprintf("fake-%v", len(f.messages)), Status: "sent"}, nil
+}
+
+// Messages returns the messages sent so far, oldest first
+func (f *Fake) Messages() []Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Message(nil), f.messages...)
+}
@@ -0,0 +1,300 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mdesson/CatFactsForever/admin"
+	"github.com/mdesson/CatFactsForever/factmanager"
+	"github.com/mdesson/CatFactsForever/scheduler"
+	"gorm.io/gorm"
+)
+
+// jobTimeout bounds each run of a subscription's job so a slow Twilio call can't stall the scheduler
+const jobTimeout = 45 * time.Second
+
+// catchUpLookback is how far back sends missed during downtime are made up, only the most recent one is sent
+const catchUpLookback = 24 * time.Hour
+
+// sendRetry retries failed sends a few times within the minute, users already sent a fact are skipped
+var sendRetry = scheduler.RetryPolicy{
+	MaxAttempts:  3,
+	InitialDelay: 10 * time.Second,
+	Multiplier:   2,
+	MaxDelay:     time.Minute,
+	Jitter:       0.2,
+}
+
+// syncMu serializes SyncJobs, and guards subscriptionJobs
+var syncMu sync.Mutex
+
+// subscriptionJobs holds the IDs of the scheduler jobs SyncJobs manages
+var subscriptionJobs = make(map[string]bool)
+
+// SyncResult counts the scheduler jobs changed by SyncJobs
+type SyncResult struct {
+	Added       int // Jobs registered for new subscriptions or users
+	Rescheduled int // Jobs whose subscription's cron string, send window or stagger, or whose time zone, changed
+	Removed     int // Jobs whose subscription or user was deleted
+}
+
+// jobSpec is the scheduler job SyncJobs wants for a subscription, or for one user of a windowed subscription
+type jobSpec struct {
+	cron     string
+	desc     string
+	jitter   time.Duration
+	stagger  time.Duration
+	location *time.Location
+	blackout *factmanager.BlackoutCalendar
+	jobFunc  scheduler.JobFunc
+}
+
+// SyncJobs keeps the scheduler's subscription jobs in step with the Subscription table
+// Subscriptions with a send window get one job per user so each user is sent at their own random time,
+// other subscriptions get a job for each time zone their users are in
+// Every job evaluates its cron string in its users' time zone
+// New jobs are registered, changed schedules are applied, and jobs of deleted subscriptions or users are removed
+// Jobs with invalid cron strings are logged and skipped so the others still send
+func SyncJobs(db *gorm.DB) (SyncResult, error) {
+	syncMu.Lock()
+	defer syncMu.Unlock()
+
+	result := SyncResult{}
+	subscriptions := []factmanager.Subscription{}
+	if err := db.Find(&subscriptions).Error; err != nil {
+		return result, fmt.Errorf("Error listing subscriptions: %v", err)
+	}
+	users := []factmanager.CatEnthusiast{}
+	if err := db.Find(&users).Error; err != nil {
+		return result, fmt.Errorf("Error listing users: %v", err)
+	}
+
+	wanted := make(map[string]jobSpec)
+	for _, subscription := range subscriptions {
+		jitter := time.Duration(subscription.JitterMinutes) * time.Minute
+		stagger := time.Duration(subscription.StaggerSeconds) * time.Second
+		if subscription.WindowMinutes <= 0 {
+			// The default time zone always has a job, so new users are sent facts before the next sync
+			zones := map[string]bool{factmanager.DefaultTimeZone: true}
+			for _, user := range users {
+				if user.SubscriptionID == subscription.ID {
+					zones[user.Zone()] = true
+				}
+			}
+			for zone := range zones {
+				loc, err := factmanager.LoadTimeZone(zone)
+				if err != nil {
+					log.Printf("Error loading time zone %v of subscription %v: %v", zone, subscription.ID, err)
+					continue
+				}
+				desc := subscription.Description
+				if zone != factmanager.DefaultTimeZone {
+					desc = fmt.Sprintf("%v in %v", desc, zone)
+				}
+				blackout := &factmanager.BlackoutCalendar{DB: db}
+				wanted[zoneJobID(subscription.ID, zone)] = jobSpec{subscription.Cron, desc, jitter, stagger, loc, blackout, SubscriptionJob(db, subscription.ID, zone)}
+			}
+			continue
+		}
+		window := time.Duration(subscription.WindowMinutes)*time.Minute + jitter
+		for _, user := range users {
+			if user.SubscriptionID != subscription.ID {
+				continue
+			}
+			loc, err := user.Location()
+			if err != nil {
+				log.Printf("Error loading time zone %v of user %v: %v", user.TimeZone, user.Name, err)
+				continue
+			}
+			desc := fmt.Sprintf("%v for %v", subscription.Description, user.Name)
+			blackout := &factmanager.BlackoutCalendar{DB: db, Category: user.FactCategory}
+			wanted[userJobID(subscription.ID, user.ID)] = jobSpec{subscription.Cron, desc, window, stagger, loc, blackout, UserJob(db, subscription.ID, user.ID)}
+		}
+	}
+
+	for id, spec := range wanted {
+		job, ok := scheduler.FindJob(id)
+		same := ok && job.Jitter == spec.jitter && job.Stagger == spec.stagger && job.Location.String() == spec.location.String()
+		if same && job.Schedule().String() == spec.cron {
+			continue
+		}
+		if same {
+			if err := scheduler.Reschedule(id, spec.cron); err != nil {
+				log.Printf("Error rescheduling job %v:\n%v", id, err)
+				continue
+			}
+			result.Rescheduled++
+			continue
+		}
+		// A changed send window, stagger or time zone needs a new job, its run state carries over through the job store
+		if ok {
+			scheduler.RemoveJob(id)
+		}
+		if err := scheduler.AddJob(id, spec.cron, spec.desc, true, spec.jobFunc, scheduler.WithTimeout(jobTimeout), scheduler.WithCatchUp(scheduler.CatchUpOnce, catchUpLookback), scheduler.WithRetry(sendRetry), scheduler.WithJitter(spec.jitter), scheduler.WithStagger(spec.stagger), scheduler.WithLocation(spec.location), scheduler.WithBlackout(spec.blackout, scheduler.BlackoutDefer)); err != nil {
+			log.Printf("Error registering cat facts job %v with scheduler:\n%v", id, err)
+			delete(subscriptionJobs, id)
+			continue
+		}
+		subscriptionJobs[id] = true
+		if ok {
+			result.Rescheduled++
+		} else {
+			result.Added++
+		}
+	}
+
+	// Remove jobs whose subscription or user no longer exists
+	for id := range subscriptionJobs {
+		if _, ok := wanted[id]; ok {
+			continue
+		}
+		scheduler.RemoveJob(id)
+		delete(subscriptionJobs, id)
+		result.Removed++
+	}
+
+	return result, nil
+}
+
+// zoneJobID returns the scheduler job ID for the users of a subscription in one time zone
+// The default time zone's job is known by the subscription ID alone
+// IDs are lower case like every argument of an admin command, so 'cancel job' and 'history job' can find them
+func zoneJobID(subscriptionID uint, zone string) string {
+	if zone == factmanager.DefaultTimeZone {
+		return fmt.Sprint(subscriptionID)
+	}
+	return fmt.Sprintf("%v@%v", subscriptionID, strings.ToLower(zone))
+}
+
+// userJobID returns the scheduler job ID for one user of a windowed subscription
+func userJobID(subscriptionID, userID uint) string {
+	return fmt.Sprintf("%v/%v", subscriptionID, userID)
+}
+
+// syncJobs runs SyncJobs after an admin command changes subscriptions, logging the outcome
+func syncJobs(db *gorm.DB) {
+	result, err := SyncJobs(db)
+	if err != nil {
+		log.Printf("Error syncing jobs: %v", err)
+		return
+	}
+	log.Printf("Synced subscription jobs: %+v", result)
+}
+
+// HandleOneShots registers the handlers of the one-shot jobs scheduled by admin commands
+// It must be called before the scheduler starts so saved one-shot jobs can be restored
+func HandleOneShots(db *gorm.DB) {
+	scheduler.HandleOneShot(admin.SendKind, sendHandler(db), scheduler.WithTimeout(jobTimeout), scheduler.WithRetry(sendRetry))
+	scheduler.HandleOneShot(admin.ResumeKind, admin.ResumeHandler(db), scheduler.WithRetry(sendRetry))
+}
+
+// sendHandler builds the jobs that text a user a message at a set time, scheduled with 'send'
+func sendHandler(db *gorm.DB) scheduler.OneShotHandler {
+	return func(payload string) (scheduler.JobFunc, error) {
+		text := admin.ScheduledText{}
+		if err := json.Unmarshal([]byte(payload), &text); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) error {
+			user := factmanager.CatEnthusiast{}
+			if err := db.Where("name = ?", text.Name).First(&user).Error; err != nil {
+				return fmt.Errorf("Error fetching user %v: %v", text.Name, err)
+			}
+			if err := sendToUser(ctx, db, user, text.Message); err != nil {
+				return fmt.Errorf("Error sending text message to %v: %v", user.Name, err)
+			}
+			scheduler.AddCount(ctx, 1)
+			return nil
+		}, nil
+	}
+}
+
+// SubscriptionJob makes the scheduler job that sends a fact to every active user of a subscription in a time zone
+// Users without a time zone of their own are in the default time zone
+func SubscriptionJob(db *gorm.DB, subscriptionID uint, zone string) scheduler.JobFunc {
+	zones := []string{zone}
+	if zone == factmanager.DefaultTimeZone {
+		zones = append(zones, "")
+	}
+	return sendJob(db, subscriptionID, func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("subscription_id = ? AND time_zone IN ?", subscriptionID, zones)
+	})
+}
+
+// UserJob makes the scheduler job that sends a fact to one user of a subscription, if they are active
+// Nothing is sent once the user has moved to another subscription
+func UserJob(db *gorm.DB, subscriptionID, userID uint) scheduler.JobFunc {
+	return sendJob(db, subscriptionID, func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("subscription_id = ? AND id = ?", subscriptionID, userID)
+	})
+}
+
+// sendJob makes a scheduler job that sends a fact to each user the query finds, each as its own task
+// A failed send doesn't stop the others, and inactive or blacked out users are skipped
+func sendJob(db *gorm.DB, subscriptionID uint, query func(*gorm.DB) *gorm.DB) scheduler.JobFunc {
+	var mu sync.Mutex
+	sent := make(map[uint]time.Time) // Scheduled minute each user was last sent a fact, so retries skip them
+	return scheduler.FanOut(func(ctx context.Context) ([]scheduler.Task, error) {
+		scheduled, _ := scheduler.ScheduledTime(ctx)
+		users := []factmanager.CatEnthusiast{}
+		if err := query(db).Find(&users).Error; err != nil {
+			return nil, fmt.Errorf("Error fetching users that have subscriptionID %v: %v", subscriptionID, err)
+		}
+
+		// Retries only send to the users that failed
+		mu.Lock()
+		defer mu.Unlock()
+		tasks := make([]scheduler.Task, 0, len(users))
+		for _, user := range users {
+			if last, ok := sent[user.ID]; ok && last.Equal(scheduled) {
+				continue
+			}
+			user := user
+			tasks = append(tasks, scheduler.Task{Name: user.Name, Run: func(ctx context.Context) error {
+				if err := sendFact(ctx, db, user); err != nil {
+					return err
+				}
+				mu.Lock()
+				sent[user.ID] = scheduled
+				mu.Unlock()
+				return nil
+			}})
+		}
+		return tasks, nil
+	})
+}
+
+// sendFact sends a fact to one user and updates their stats
+// Returns scheduler.ErrSkipped if the user is inactive or their category is blacked out
+func sendFact(ctx context.Context, db *gorm.DB, user factmanager.CatEnthusiast) error {
+	if !user.Active {
+		return scheduler.ErrSkipped
+	}
+	// Jobs of a whole subscription are only blacked out globally, so skip users whose category is blacked out
+	// Quiet hours are in the user's time zone
+	now := time.Now()
+	if loc, err := user.Location(); err == nil {
+		now = now.In(loc)
+	}
+	calendar := &factmanager.BlackoutCalendar{DB: db, Category: user.FactCategory}
+	if until, _, err := calendar.BlackedOut(now); err != nil {
+		return fmt.Errorf("Error checking blackouts: %v", err)
+	} else if !until.IsZero() {
+		return scheduler.ErrSkipped
+	}
+	msg := factmanager.MakeFactMessage(user.FactCategory, db)
+	if err := sendToUser(ctx, db, user, msg); err != nil {
+		return err
+	}
+	// If no error occurred, update the total messages sent to the user and the total number of thanks
+	// The fact was sent either way, so a failed update is only logged to keep retries from sending it again
+	if err := db.Model(&user).Updates(&factmanager.CatEnthusiast{TotalSent: (user.TotalSent + 1), TotalSentSession: (user.TotalSentSession + 1)}).Error; err != nil {
+		log.Printf("Error updating user %v's stats: %v", user.Name, err)
+	}
+	return nil
+}
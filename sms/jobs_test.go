@@ -0,0 +1,128 @@
+package sms
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mdesson/CatFactsForever/factmanager"
+	"github.com/mdesson/CatFactsForever/scheduler"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// fakeDB makes a database that runs no SQL, queries into a slice are answered with the given slice of the same type
+// and queries for anything else find nothing
+func fakeDB(t *testing.T, tables ...interface{}) *gorm.DB {
+	conn, err := sql.Open("pgx", "")
+	if err != nil {
+		t.Fatalf("Error opening fake database: %v", err)
+	}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("Error opening fake database: %v", err)
+	}
+	db.Callback().Query().After("gorm:query").Register("test:find", func(tx *gorm.DB) {
+		dest := reflect.ValueOf(tx.Statement.Dest)
+		for _, table := range tables {
+			if rows := reflect.ValueOf(table); dest.Kind() == reflect.Ptr && dest.Elem().Type() == rows.Type() {
+				dest.Elem().Set(rows)
+				tx.RowsAffected = int64(rows.Len())
+			}
+		}
+	})
+	return db
+}
+
+func TestSendJob(t *testing.T) {
+	fake := &Fake{Fail: func(msg Message) error {
+		if msg.To == "+15145550002" {
+			return errors.New("twilio is down")
+		}
+		return nil
+	}}
+	defer useAdmins(fake)()
+	db := fakeDB(t,
+		[]factmanager.CatEnthusiast{
+			{Model: gorm.Model{ID: 1}, Name: "mittens", PhoneNumber: "+15145550001", Active: true, FactCategory: "cat"},
+			{Model: gorm.Model{ID: 2}, Name: "tom", PhoneNumber: "+15145550002", Active: true, FactCategory: "cat"},
+			{Model: gorm.Model{ID: 3}, Name: "garfield", PhoneNumber: "+15145550003", Active: false, FactCategory: "cat"},
+		},
+		[]factmanager.Fact{{Body: "Cats sleep 16 hours a day", Category: "cat"}},
+		[]factmanager.Greeting{{Body: "Thanks for subscribing to CAT FACTS!", Category: "cat"}},
+	)
+	job := SubscriptionJob(db, 1, factmanager.DefaultTimeZone)
+
+	// A failed send doesn't stop the others, and inactive users are skipped
+	err := job(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "tom: twilio is down") {
+		t.Errorf("job returned %v, want tom's send to fail", err)
+	}
+	messages := fake.Messages()
+	if len(messages) != 1 || messages[0].To != "+15145550001" {
+		t.Fatalf("sent %+v, want a fact to mittens only", messages)
+	}
+	if want := "Thanks for subscribing to CAT FACTS!\n\nCats sleep 16 hours a day"; messages[0].Body != want {
+		t.Errorf("sent %q, want %q", messages[0].Body, want)
+	}
+
+	// Retries of the same run only send to the users that failed
+	fake.Fail = nil
+	if err := job(context.Background()); err != nil {
+		t.Errorf("retried job returned %v", err)
+	}
+	messages = fake.Messages()
+	if len(messages) != 2 || messages[1].To != "+15145550002" {
+		t.Errorf("retry sent %+v, want a fact to tom only", messages[1:])
+	}
+}
+
+func TestSendJobFetchError(t *testing.T) {
+	fake := &Fake{}
+	defer useAdmins(fake)()
+	db := fakeDB(t)
+	db.Callback().Query().Before("gorm:query").Register("test:fail", func(tx *gorm.DB) {
+		tx.AddError(errors.New("connection refused"))
+	})
+
+	err := SubscriptionJob(db, 1, factmanager.DefaultTimeZone)(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("job returned %v, want the query's error", err)
+	}
+	if messages := fake.Messages(); len(messages) != 0 {
+		t.Errorf("sent %+v without users", messages)
+	}
+}
+
+func TestZoneJobIDs(t *testing.T) {
+	if id := zoneJobID(1, factmanager.DefaultTimeZone); id != "1" {
+		t.Errorf("zoneJobID() = %q for the default time zone, want the subscription ID", id)
+	}
+	id := zoneJobID(1, "America/Vancouver")
+	if id != "1@america/vancouver" {
+		t.Errorf("zoneJobID() = %q, want it in lower case", id)
+	}
+
+	// Admin commands lower case their arguments, so they must still find jobs in other time zones
+	defer useAdmins(&Fake{})()
+	if err := scheduler.AddJob(id, "0 10 * * *", "", true, func(context.Context) error { return nil }); err != nil {
+		t.Fatalf("AddJob returned error %v", err)
+	}
+	defer scheduler.RemoveJob(id)
+	for _, test := range []struct{ command, want string }{
+		{"cancel job 1@America/Vancouver", "job 1@america/vancouver is not running"},
+		{"remove job 1@America/Vancouver", "removed job 1@america/vancouver"},
+	} {
+		w := httptest.NewRecorder()
+		MakeResponseHandler(nil)(w, post("/sms", url.Values{"Body": {test.command}, "From": {"+15145550001"}}.Encode(), ""))
+		if got := w.Body.String(); !strings.Contains(got, test.want) {
+			t.Errorf("%q replied %q, want %q", test.command, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package sms
+
+import (
+	"context"
+	"errors"
+)
+
+// Message is a text message to send
+type Message struct {
+	To   string // Phone number to send to
+	From string // Phone number to send from, the Sender's own number if empty
+	Body string // Text of the message
+}
+
+// Result describes a message the provider accepted
+type Result struct {
+	ID     string // Provider's ID of the message
+	Status string // Provider's status of the message, such as "queued"
+}
+
+// Sender sends text messages through an SMS provider
+type Sender interface {
+	Send(ctx context.Context, msg Message) (Result, error)
+}
+
+// ErrNoSender is returned by SendText before a Sender has been set with SetSender
+var ErrNoSender = errors.New("no SMS sender set")
+
+// sender sends the texts of SendText, nil until SetSender is called
+var sender Sender
+
+// SetSender replaces the Sender used by SendText
+// It should be called before any texts are sent or the scheduler is started
+func SetSender(s Sender) {
+	sender = s
+}
+
+// SendText sends an sms message to the specified number with the Sender set by SetSender
+func SendText(ctx context.Context, msg, to string) (Result, error) {
+	if sender == nil {
+		return Result{}, ErrNoSender
+	}
+	return sender.Send(ctx, Message{To: to, Body: msg})
+}
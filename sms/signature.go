@@ -0,0 +1,81 @@
+package sms
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// SignatureHeader is the header Twilio signs its webhook requests with
+const SignatureHeader = "X-Twilio-Signature"
+
+// Signature computes Twilio's signature of a request to the full URL with the given form parameters
+// It is the base64 HMAC-SHA1, keyed with the auth token, of the URL followed by each parameter's name and value sorted by name
+func Signature(token, fullURL string, params url.Values) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(fullURL)
+	for _, key := range keys {
+		values := append([]string(nil), params[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			b.WriteString(key)
+			b.WriteString(value)
+		}
+	}
+
+	mac := hmac.New(sha1.New, []byte(token))
+	mac.Write([]byte(b.String()))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ValidSignature reports if signature is Twilio's signature of a request to the full URL with the given form parameters
+func ValidSignature(token, fullURL string, params url.Values, signature string) bool {
+	if token == "" || signature == "" {
+		return false
+	}
+	return hmac.Equal([]byte(Signature(token, fullURL, params)), []byte(signature))
+}
+
+// RequireSignature wraps a webhook handler so only requests signed by Twilio with the auth token reach it
+// Others are rejected with 403 Forbidden
+// publicURL is the scheme and host Twilio posts to, such as https://catfacts.example.com, for servers behind
+// a reverse proxy. If empty, the URL is rebuilt from the request
+func RequireSignature(token, publicURL string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// The form stays parsed for the handler
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "malformed form body", http.StatusBadRequest)
+			return
+		}
+		fullURL := requestURL(r, publicURL)
+		if !ValidSignature(token, fullURL, r.PostForm, r.Header.Get(SignatureHeader)) {
+			log.Printf("Rejected request to %v from %v with an invalid Twilio signature", fullURL, r.RemoteAddr)
+			http.Error(w, "invalid signature", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// requestURL returns the URL Twilio posted the request to, as used in its signature
+func requestURL(r *http.Request, publicURL string) string {
+	if publicURL != "" {
+		return strings.TrimSuffix(publicURL, "/") + r.URL.RequestURI()
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + r.URL.RequestURI()
+}
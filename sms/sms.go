@@ -3,12 +3,10 @@ package sms
 import (
 	"encoding/xml"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
-	"net/url"
 	"os"
-	"strconv"
+	"runtime/debug"
 	"strings"
 
 	"github.com/mdesson/CatFactsForever/admin"
@@ -19,48 +17,39 @@ import (
 // Response is a Twilio sms response to be sent as xml
 // It can contain any number of text Messages
 type Response struct {
-	Message []string `xml:Message>Body`
+	Message []string `xml:"Message"`
 }
 
-// SendText sends an sms message to the specified number
-func SendText(msg, sid, token, to, from string) int {
-	// Config for text message
-	data := url.Values{}
-	data.Set("To", to)
-	data.Set("From", from)
-	data.Set("Body", msg)
-
-	msgURL := fmt.Sprintf("https://api.twilio.com/2010-04-01/Accounts/%s/Messages.json", sid)
-
-	// Set up request
-	r, _ := http.NewRequest(http.MethodPost, msgURL, strings.NewReader(data.Encode()))
-	r.SetBasicAuth(sid, token)
-	r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	r.Header.Add("Content-Length", strconv.Itoa(len(data.Encode())))
-
-	// Send Request
-	client := &http.Client{}
-	resp, _ := client.Do(r)
-
-	return resp.StatusCode
+// RecoverPanics is router middleware that answers a request whose handler panicked with 500 Internal Server Error
+// The panic is logged with its stack instead of crashing the server
+func RecoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if err := recover(); err != nil {
+				log.Printf("Recovered panic handling %v %v: %v\n%s", r.Method, r.URL.Path, err, debug.Stack())
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
 }
 
 // MakeResponseHandler generates an http handler that sends responses to sms messages as they come in
 func MakeResponseHandler(db *gorm.DB) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		body, err := ioutil.ReadAll(r.Body)
-		if err != nil {
-			log.Fatalf("Error decoding request body:\n%v", err)
-		}
-
-		bodyMap, err := url.ParseQuery(string(body))
-		if err != nil {
-			log.Fatalf("Error converting body to map:\n%v", err)
+		if err := r.ParseForm(); err != nil {
+			log.Printf("Error parsing incoming text: %v", err)
+			http.Error(w, "malformed form body", http.StatusBadRequest)
+			return
 		}
 
 		// Get the income message and phone number of user
-		incomingMsg := bodyMap["Body"][0]
-		phoneNumber := bodyMap["From"][0]
+		if _, ok := r.PostForm["Body"]; !ok || r.PostForm.Get("From") == "" {
+			http.Error(w, "Body and From are required", http.StatusBadRequest)
+			return
+		}
+		incomingMsg := r.PostForm.Get("Body")
+		phoneNumber := r.PostForm.Get("From")
 
 		// declarations of user, their subscription, and the xml to be marshalled
 		user := factmanager.CatEnthusiast{}
@@ -68,16 +57,18 @@ func MakeResponseHandler(db *gorm.DB) func(w http.ResponseWriter, r *http.Reques
 		var x []byte
 
 		if phoneNumber == os.Getenv("ADMIN_PHONE_1") || phoneNumber == os.Getenv("ADMIN_PHONE_2") {
-			// all input is case insensitive, all db data is stored in lower case
-			incomingMsg = strings.ToLower(incomingMsg)
-
 			// trim any leading/trailing whitespace
 			incomingMsg = strings.TrimSpace(incomingMsg)
 
 			// Get admin command and its arguments
+			// all input is case insensitive, all db data is stored in lower case
+			// words keeps the original case for the text of messages scheduled with send
 			words := strings.Split(incomingMsg, " ")
-			cmd := words[0]
-			args := words[1:]
+			cmd := strings.ToLower(words[0])
+			args := make([]string, 0, len(words)-1)
+			for _, word := range words[1:] {
+				args = append(args, strings.ToLower(word))
+			}
 
 			// Declare reply to admin
 			var reply string
@@ -85,19 +76,29 @@ func MakeResponseHandler(db *gorm.DB) func(w http.ResponseWriter, r *http.Reques
 			// Parse command and its arguments
 			if cmd == "help" {
 				reply = admin.Help()
+			} else if cmd == "status" {
+				reply = admin.Status()
 			} else if cmd == "add" {
-				if len(args) != 4 {
+				if len(args) != 4 && len(args) != 5 {
 					reply = "bad format for adding. see help"
 				} else {
 					var ok bool
-					var freq string
-					reply, freq, ok = admin.Add(args[0], args[1], args[2], args[3], db)
+					var schedule, zone string
+					if len(args) == 5 {
+						zone = args[4]
+					}
+					reply, schedule, ok = admin.Add(args[0], args[1], args[2], args[3], zone, db)
 					if ok {
+						syncJobs(db)
 						// welcome user to cat facts with their first fact
 						fact := factmanager.GetRandomFact(db, args[3])
 						msg := "Welcome to CAT FACTS! We deliver purrfectly accurate feline friend facts and sometimes pawful puns straight to your smartphone!"
-						msg = fmt.Sprintf("%v You will receive a CAT FACT <%v>. Reply UNSUBSCRIBE to unsubscribe.\n%v", msg, freq, fact)
-						SendText(msg, os.Getenv("SID"), os.Getenv("TOKEN"), args[1], os.Getenv("FROM"))
+						msg = fmt.Sprintf("%v You will receive a CAT FACT %v. Reply UNSUBSCRIBE to unsubscribe.\n%v", msg, schedule, fact)
+						if err := db.Where("name = ?", args[0]).First(&user).Error; err != nil {
+							log.Printf("Error fetching new user %v: %v", args[0], err)
+						} else if err := sendToUser(r.Context(), db, user, msg); err != nil {
+							log.Printf("Error sending welcome text to %v: %v", args[0], err)
+						}
 					}
 				}
 			} else if cmd == "start" {
@@ -107,10 +108,18 @@ func MakeResponseHandler(db *gorm.DB) func(w http.ResponseWriter, r *http.Reques
 					reply = admin.Start(args[0], db)
 				}
 			} else if cmd == "stop" {
-				if len(args) != 1 {
+				if len(args) == 1 {
+					reply = admin.Stop(args[0], db)
+				} else if len(args) == 2 {
+					reply = admin.StopFor(args[0], args[1], db)
+				} else {
 					reply = "bad format for stop. see help"
+				}
+			} else if cmd == "send" {
+				if len(args) < 4 {
+					reply = "bad format for send. see help"
 				} else {
-					reply = admin.Stop(args[0], db)
+					reply = admin.ScheduleText(args[0], args[1], args[2], strings.Join(words[4:], " "), db)
 				}
 			} else if cmd == "info" {
 				if len(args) != 1 {
@@ -119,10 +128,15 @@ func MakeResponseHandler(db *gorm.DB) func(w http.ResponseWriter, r *http.Reques
 					reply = admin.Info(args[0], db)
 				}
 			} else if cmd == "update" {
-				if len(args) != 2 {
+				if len(args) != 2 && len(args) != 3 {
 					reply = "bad format for update. see help"
 				} else {
-					reply = admin.Update(args[0], args[1], db)
+					var zone string
+					if len(args) == 3 {
+						zone = args[2]
+					}
+					reply = admin.Update(args[0], args[1], zone, db)
+					syncJobs(db)
 				}
 			} else if cmd == "list" {
 				if len(args) != 1 {
@@ -136,10 +150,54 @@ func MakeResponseHandler(db *gorm.DB) func(w http.ResponseWriter, r *http.Reques
 				} else {
 					reply = "can't list that. See help"
 				}
+			} else if cmd == "preview" {
+				if len(args) != 1 {
+					reply = "bad format for preview. see help"
+				} else {
+					reply = admin.Preview(args[0], db)
+				}
+			} else if cmd == "cancel" {
+				if len(args) != 2 || args[0] != "job" {
+					reply = "bad format for cancel. try 'cancel job id'"
+				} else {
+					reply = admin.CancelJob(args[1])
+				}
+			} else if cmd == "remove" {
+				if len(args) != 2 || args[0] != "job" {
+					reply = "bad format for remove. try 'remove job id'"
+				} else {
+					reply = admin.RemoveJob(args[1])
+				}
+			} else if cmd == "history" {
+				if len(args) != 2 || args[0] != "job" {
+					reply = "bad format for history. try 'history job id'"
+				} else {
+					reply = admin.JobHistory(args[1], db)
+				}
+			} else if cmd == "sync" {
+				if len(args) != 1 || args[0] != "jobs" {
+					reply = "bad format for sync. try 'sync jobs'"
+				} else if result, err := SyncJobs(db); err != nil {
+					log.Printf("Error syncing jobs: %v", err)
+					reply = "an error occurred syncing jobs"
+				} else {
+					reply = fmt.Sprintf("synced jobs: %v added, %v updated, %v removed", result.Added, result.Rescheduled, result.Removed)
+				}
+			} else if cmd == "blackout" {
+				if len(args) >= 2 && args[0] == "add" {
+					reply = admin.AddBlackout(args[1:], db)
+				} else if len(args) == 1 && args[0] == "list" {
+					reply = admin.ListBlackouts(db)
+				} else if len(args) == 2 && args[0] == "remove" {
+					reply = admin.RemoveBlackout(args[1], db)
+				} else {
+					reply = "bad format for blackout. see help"
+				}
 			} else if cmd == "reset" {
 				if len(args) == 1 && args[0] == "confirm" {
 					factmanager.Reset(db)
 					reply = "deleted all tables in database"
+					syncJobs(db)
 				} else {
 					reply = "invalid reset command. be careful, this command is destructive"
 				}
@@ -149,6 +207,7 @@ func MakeResponseHandler(db *gorm.DB) func(w http.ResponseWriter, r *http.Reques
 						reply = fmt.Sprintf("Error populating: %v", err)
 					} else {
 						reply = "repopulated database with starter data"
+						syncJobs(db)
 					}
 				} else {
 					reply = "invalid populate command. be careful, this command is destructive"
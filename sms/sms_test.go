@@ -0,0 +1,166 @@
+package sms
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// post makes a form post to path with the given body and Twilio signature
+func post(path, body, signature string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if signature != "" {
+		r.Header.Set(SignatureHeader, signature)
+	}
+	return r
+}
+
+func TestSignature(t *testing.T) {
+	// Example from Twilio's documentation on validating requests
+	params := url.Values{
+		"CallSid": {"CA1234567890ABCDE"},
+		"Caller":  {"+12349013030"},
+		"Digits":  {"1234"},
+		"From":    {"+12349013030"},
+		"To":      {"+18005551212"},
+	}
+	fullURL := "https://mycompany.com/myapp.php?foo=1&bar=2"
+	want := "0/KCTR6DLpKmkAf8muzZqo1nDgQ="
+	if got := Signature("12345", fullURL, params); got != want {
+		t.Errorf("Signature() = %q, want %q", got, want)
+	}
+	if !ValidSignature("12345", fullURL, params, want) {
+		t.Errorf("ValidSignature() = false for Twilio's signature")
+	}
+	if ValidSignature("54321", fullURL, params, want) {
+		t.Errorf("ValidSignature() = true with the wrong token")
+	}
+	if ValidSignature("", fullURL, params, Signature("", fullURL, params)) {
+		t.Errorf("ValidSignature() = true without a token")
+	}
+}
+
+func TestRequireSignature(t *testing.T) {
+	token := "secret"
+	body := url.Values{"Body": {"reset confirm"}, "From": {"+15145551234"}}
+	signed := func(fullURL string) string {
+		return Signature(token, fullURL, body)
+	}
+	tests := []struct {
+		name      string
+		publicURL string
+		signature string
+		want      int
+	}{
+		{"valid", "", signed("http://example.com/sms"), http.StatusOK},
+		{"behind a proxy", "https://catfacts.example.com/", signed("https://catfacts.example.com/sms"), http.StatusOK},
+		{"proxy not configured", "", signed("https://catfacts.example.com/sms"), http.StatusForbidden},
+		{"forged", "", "bm90IGEgc2lnbmF0dXJl", http.StatusForbidden},
+		{"missing", "", "", http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		reached := false
+		handler := RequireSignature(token, test.publicURL, func(w http.ResponseWriter, r *http.Request) {
+			reached = true
+			if r.PostForm.Get("Body") != "reset confirm" {
+				t.Errorf("%v: handler got Body %q, want the posted one", test.name, r.PostForm.Get("Body"))
+			}
+		})
+		w := httptest.NewRecorder()
+		handler(w, post("/sms", body.Encode(), test.signature))
+		if w.Code != test.want {
+			t.Errorf("%v: got status %v, want %v", test.name, w.Code, test.want)
+		}
+		if reached != (test.want == http.StatusOK) {
+			t.Errorf("%v: handler reached = %v, want %v", test.name, reached, test.want == http.StatusOK)
+		}
+	}
+}
+
+func TestResponseHandlerBadInput(t *testing.T) {
+	handler := MakeResponseHandler(nil)
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"malformed", "Body=%zz&From=+15145551234"},
+		{"no sender", "Body=help"},
+		{"no message", "From=%2B15145551234"},
+		{"empty", ""},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		handler(w, post("/sms", test.body, ""))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%v: got status %v, want %v", test.name, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestResponseHandlerAdminCommand(t *testing.T) {
+	admin := "+15145551234"
+	old := os.Getenv("ADMIN_PHONE_1")
+	os.Setenv("ADMIN_PHONE_1", admin)
+	defer os.Setenv("ADMIN_PHONE_1", old)
+
+	w := httptest.NewRecorder()
+	MakeResponseHandler(nil)(w, post("/sms", url.Values{"Body": {" HELP "}, "From": {admin}}.Encode(), ""))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %v, want %v", w.Code, http.StatusOK)
+	}
+	if got := w.Body.String(); !strings.HasPrefix(got, "<Response><Message>Admin commands are:") {
+		t.Errorf("replied %q, want the help text", got)
+	}
+}
+
+func TestRecoverPanics(t *testing.T) {
+	r := mux.NewRouter()
+	r.Use(RecoverPanics)
+	r.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("index out of range")
+	})
+	r.HandleFunc("/fine", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("meow"))
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, post("/panic", "", ""))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("panicking handler got status %v, want %v", w.Code, http.StatusInternalServerError)
+	}
+
+	// The router keeps serving other requests
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, post("/fine", "", ""))
+	if w.Code != http.StatusOK || w.Body.String() != "meow" {
+		t.Errorf("got %v %q after a panic, want 200 meow", w.Code, w.Body.String())
+	}
+}
+
+func TestStatusHandlerBadInput(t *testing.T) {
+	handler := MakeStatusHandler(nil)
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"malformed", "MessageSid=%zz"},
+		{"no message", "MessageStatus=delivered"},
+		{"no status", "MessageSid=SM123"},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		handler(w, post("/sms/status", test.body, ""))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%v: got status %v, want %v", test.name, w.Code, http.StatusBadRequest)
+		}
+	}
+}
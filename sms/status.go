@@ -0,0 +1,52 @@
+package sms
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/mdesson/CatFactsForever/factmanager"
+	"gorm.io/gorm"
+)
+
+// sendToUser texts a user and records the message so its delivery status can be tracked
+// A message that can't be recorded was still sent, so that is only logged
+func sendToUser(ctx context.Context, db *gorm.DB, user factmanager.CatEnthusiast, msg string) error {
+	result, err := SendText(ctx, msg, user.PhoneNumber)
+	if err != nil {
+		return err
+	}
+	if result.ID == "" {
+		return nil
+	}
+	if err := factmanager.RecordOutboundMessage(db, result.ID, user.ID, result.Status); err != nil {
+		log.Printf("Error recording message %v to %v: %v", result.ID, user.Name, err)
+	}
+	return nil
+}
+
+// MakeStatusHandler generates an http handler that records the delivery status Twilio posts for each sent message
+func MakeStatusHandler(db *gorm.DB) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "malformed form body", http.StatusBadRequest)
+			return
+		}
+		sid, status := r.PostForm.Get("MessageSid"), r.PostForm.Get("MessageStatus")
+		if sid == "" || status == "" {
+			http.Error(w, "MessageSid and MessageStatus are required", http.StatusBadRequest)
+			return
+		}
+
+		errorCode := r.PostForm.Get("ErrorCode")
+		if errorCode != "" {
+			log.Printf("Message %v to %v is %v with error code %v", sid, r.PostForm.Get("To"), status, errorCode)
+		}
+		if err := factmanager.UpdateMessageStatus(db, sid, status, errorCode); err != nil {
+			log.Printf("Error updating status of message %v: %v", sid, err)
+			http.Error(w, "error recording status", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
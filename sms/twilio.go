@@ -0,0 +1,134 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// twilioAPIURL is the root of Twilio's REST API
+const twilioAPIURL = "https://api.twilio.com"
+
+// maxTwilioResponse is the most of a Twilio response that is read
+const maxTwilioResponse = 1 << 20
+
+// twilioClient makes the requests of a Twilio without its own Client, so a hung connection can't block a send forever
+var twilioClient = &http.Client{
+	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 20 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConnsPerHost:   10,
+	},
+}
+
+// Twilio sends text messages with Twilio's REST API
+type Twilio struct {
+	SID    string       // Account SID
+	Token  string       // Auth token
+	From   string       // Twilio phone number messages are sent from
+	Client *http.Client // Client the requests are made with, one with timeouts if nil
+	APIURL string       // Root of Twilio's REST API, https://api.twilio.com if empty
+	// URL Twilio posts each message's delivery status to, such as https://catfacts.example.com/sms/status
+	// Statuses aren't posted if empty
+	StatusCallback string
+}
+
+// Send sends an sms message through Twilio, returning the message's SID and status
+// A message Twilio refuses fails with a *TwilioError
+func (t *Twilio) Send(ctx context.Context, msg Message) (Result, error) {
+	from := msg.From
+	if from == "" {
+		from = t.From
+	}
+
+	// Config for text message
+	data := url.Values{}
+	data.Set("To", msg.To)
+	data.Set("From", from)
+	data.Set("Body", msg.Body)
+	if t.StatusCallback != "" {
+		data.Set("StatusCallback", t.StatusCallback)
+	}
+
+	apiURL := t.APIURL
+	if apiURL == "" {
+		apiURL = twilioAPIURL
+	}
+	msgURL := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", apiURL, t.SID)
+
+	// Set up request
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, msgURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return Result{}, fmt.Errorf("Error creating Twilio request: %v", err)
+	}
+	r.SetBasicAuth(t.SID, t.Token)
+	r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Add("Content-Length", strconv.Itoa(len(data.Encode())))
+
+	// Send Request
+	client := t.Client
+	if client == nil {
+		client = twilioClient
+	}
+	resp, err := client.Do(r)
+	if err != nil {
+		return Result{}, fmt.Errorf("Error sending text message: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxTwilioResponse))
+	if err != nil {
+		return Result{}, fmt.Errorf("Error reading Twilio response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		return Result{}, newTwilioError(resp.StatusCode, body)
+	}
+	message := twilioMessage{}
+	if err := json.Unmarshal(body, &message); err != nil {
+		return Result{}, fmt.Errorf("Error decoding Twilio response: %v", err)
+	}
+	return Result{ID: message.SID, Status: message.Status}, nil
+}
+
+// twilioMessage is the part of Twilio's message resource returned when a message is created
+type twilioMessage struct {
+	SID    string `json:"sid"`
+	Status string `json:"status"`
+}
+
+// TwilioError is returned by Twilio.Send when Twilio refuses a message
+type TwilioError struct {
+	StatusCode int    `json:"status"`    // HTTP status of the response
+	Code       int    `json:"code"`      // Twilio's error code, zero if the response had none
+	Message    string `json:"message"`   // Twilio's description of the error
+	MoreInfo   string `json:"more_info"` // Link to Twilio's documentation of the error code
+}
+
+// newTwilioError decodes Twilio's error payload, falling back on the HTTP status if it isn't JSON
+func newTwilioError(statusCode int, body []byte) *TwilioError {
+	e := &TwilioError{}
+	if err := json.Unmarshal(body, e); err != nil || e.Message == "" {
+		e.Message = http.StatusText(statusCode)
+	}
+	e.StatusCode = statusCode
+	return e
+}
+
+func (e *TwilioError) Error() string {
+	if e.Code == 0 {
+		return fmt.Sprintf("Twilio responded with code %v: %v", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("Twilio error %v (HTTP %v): %v, see %v", e.Code, e.StatusCode, e.Message, e.MoreInfo)
+}
@@ -0,0 +1,126 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// twilioServer fakes Twilio's message API, answering every request with the given status and body
+func twilioServer(t *testing.T, status int, body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/2010-04-01/Accounts/AC123/Messages.json" {
+			t.Errorf("request to %v, want the account's messages", r.URL.Path)
+		}
+		if sid, token, ok := r.BasicAuth(); !ok || sid != "AC123" || token != "secret" {
+			t.Errorf("request authenticated as %v:%v, want the account's SID and token", sid, token)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+}
+
+func TestTwilioSend(t *testing.T) {
+	var form map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = map[string]string{"To": r.PostForm.Get("To"), "From": r.PostForm.Get("From"), "Body": r.PostForm.Get("Body"), "StatusCallback": r.PostForm.Get("StatusCallback")}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"sid": "SM123", "status": "queued", "body": "Cats sleep 16 hours a day"}`))
+	}))
+	defer server.Close()
+
+	twilio := &Twilio{SID: "AC123", Token: "secret", From: "+15145550000", APIURL: server.URL, StatusCallback: "https://catfacts.example.com/sms/status"}
+	result, err := twilio.Send(context.Background(), Message{To: "+15145551234", Body: "Cats sleep 16 hours a day"})
+	if err != nil {
+		t.Fatalf("Send() returned error %v", err)
+	}
+	if result != (Result{ID: "SM123", Status: "queued"}) {
+		t.Errorf("Send() = %+v, want the message's SID and status", result)
+	}
+	want := map[string]string{"To": "+15145551234", "From": "+15145550000", "Body": "Cats sleep 16 hours a day", "StatusCallback": "https://catfacts.example.com/sms/status"}
+	for key, value := range want {
+		if form[key] != value {
+			t.Errorf("posted %v = %q, want %q", key, form[key], value)
+		}
+	}
+}
+
+func TestTwilioSendErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   TwilioError
+	}{
+		{
+			"json error",
+			http.StatusBadRequest,
+			`{"code": 21211, "message": "The 'To' number is not a valid phone number.", "more_info": "https://www.twilio.com/docs/errors/21211", "status": 400}`,
+			TwilioError{StatusCode: 400, Code: 21211, Message: "The 'To' number is not a valid phone number.", MoreInfo: "https://www.twilio.com/docs/errors/21211"},
+		},
+		{"not json", http.StatusBadGateway, "<html>bad gateway</html>", TwilioError{StatusCode: 502, Message: "Bad Gateway"}},
+		{"empty", http.StatusUnauthorized, "", TwilioError{StatusCode: 401, Message: "Unauthorized"}},
+	}
+
+	for _, test := range tests {
+		server := twilioServer(t, test.status, test.body)
+		twilio := &Twilio{SID: "AC123", Token: "secret", APIURL: server.URL}
+		_, err := twilio.Send(context.Background(), Message{To: "+15145551234", Body: "meow"})
+		server.Close()
+
+		var twilioErr *TwilioError
+		if !errors.As(err, &twilioErr) {
+			t.Errorf("%v: Send() returned %v, want a *TwilioError", test.name, err)
+			continue
+		}
+		if *twilioErr != test.want {
+			t.Errorf("%v: Send() returned %+v, want %+v", test.name, *twilioErr, test.want)
+		}
+	}
+}
+
+func TestTwilioSendTransportErrors(t *testing.T) {
+	// The server is gone
+	server := twilioServer(t, http.StatusCreated, `{"sid": "SM123"}`)
+	server.Close()
+	twilio := &Twilio{SID: "AC123", Token: "secret", APIURL: server.URL}
+	_, err := twilio.Send(context.Background(), Message{To: "+15145551234", Body: "meow"})
+	var twilioErr *TwilioError
+	if err == nil || errors.As(err, &twilioErr) {
+		t.Errorf("Send() to a closed server returned %v, want a transport error", err)
+	}
+
+	// The server hangs
+	release := make(chan struct{})
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	twilio = &Twilio{SID: "AC123", Token: "secret", APIURL: server.URL, Client: &http.Client{Timeout: 20 * time.Millisecond}}
+	start := time.Now()
+	if _, err := twilio.Send(context.Background(), Message{To: "+15145551234", Body: "meow"}); err == nil {
+		t.Errorf("Send() to a hung server returned no error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Send() to a hung server took %v, want it to time out", elapsed)
+	}
+
+	twilio.Client = &http.Client{}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := twilio.Send(ctx, Message{To: "+15145551234", Body: "meow"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Send() with an expired context returned %v, want context.DeadlineExceeded", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := twilio.Send(ctx, Message{To: "+15145551234", Body: "meow"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Send() with a cancelled context returned %v, want context.Canceled", err)
+	}
+}